@@ -0,0 +1,286 @@
+package goexpr
+
+import "unicode/utf8"
+
+// Node is a node of the public syntax tree of an expression, returned by Expr.AST.
+// the tree is a copy of the one evaluated by the expression, modifying it has no effect on the expression
+type Node interface {
+	Pos() Position // position of the first character of the node
+	End() Position // position following the last character of the node
+}
+
+type span struct {
+	pos, end Position
+}
+
+func (s span) Pos() Position { return s.pos }
+func (s span) End() Position { return s.end }
+
+type (
+	// Literal is a number, a string, a char, a bool or nil, or a constant folded at compile time,
+	// such as 3 for 1 + 2 or [1, 2] for the array on the right of in
+	Literal struct {
+		span
+		Value interface{} // int64, float64, string, rune, bool, nil or []interface{} of them
+	}
+
+	// Variable is a parameter, such as a
+	Variable struct {
+		span
+		Name string
+	}
+
+	// Selector is a field or a key of a value, such as b of a.b, or of a?.b when Optional
+	Selector struct {
+		span
+		X        Node
+		Field    string
+		Optional bool // the selector and the following ones yield nil when X is nil
+	}
+
+	// Index is an element, a field or a key of a value, such as a[0] or a[key]
+	Index struct {
+		span
+		X     Node
+		Index Node
+	}
+
+	// Unary is a prefix operator, such as !a or -a
+	Unary struct {
+		span
+		Op TokenType
+		X  Node
+	}
+
+	// Binary is an operator between two operands, such as a + b or a in b
+	Binary struct {
+		span
+		Op   TokenType
+		X, Y Node
+	}
+
+	// Ternary is cond ? then : else, Else is nil when there is no else branch
+	Ternary struct {
+		span
+		Cond, Then, Else Node
+	}
+
+	// Call is a function call, or a method call when Receiver is not nil
+	Call struct {
+		span
+		Name     string
+		Receiver Node
+		Args     []Node
+	}
+
+	// Array is an array literal, such as [a, b]
+	Array struct {
+		span
+		Elems []Node
+	}
+)
+
+// AST returns the syntax tree of the expression, nil for an empty expression.
+// constant subtrees are folded and parentheses are removed, unless WithoutOptimization is given
+func (expr *Expr) AST() Node {
+	e := exporter{input: expr.input}
+	return e.export(expr.astNode)
+}
+
+// exporter builds the public syntax tree from the AST
+type exporter struct {
+	input string
+	nodes map[*astNode]Node // public node of every node exported, if not nil
+}
+
+func (e exporter) export(node *astNode) Node {
+	n := e.exportNode(node)
+	if e.nodes != nil && node != nil {
+		e.nodes[node] = n
+	}
+	return n
+}
+
+func (e exporter) exportNode(node *astNode) Node {
+	if node == nil {
+		return nil
+	}
+	s := span{pos: node.pos, end: node.end}
+	if node.constant {
+		return &Literal{span: s, Value: copyValue(node.value)}
+	}
+
+	switch node.operator {
+	case CLAUSE:
+		return e.export(node.right)
+	case VARIABLE, SELECTOR:
+		return e.segments(e.path(node.path, node.pos), node.rightList, false)
+	case LITERAL:
+		// path segments following a function or a method
+		return e.segments(e.export(node.left), node.rightList, false)
+	case OPTIONAL:
+		return e.segments(e.export(node.left), node.rightList, true)
+	case FUNC:
+		return &Call{span: s, Name: node.name, Receiver: e.export(node.left), Args: e.exportList(node.rightList)}
+	case ARRAY:
+		return &Array{span: s, Elems: e.exportList(node.rightList)}
+	case TERNARY_IF:
+		ternary := &Ternary{span: s, Cond: e.export(node.left), Then: e.export(node.right)}
+		if node.right.operator == TERNARY_ELSE {
+			ternary.Then, ternary.Else = e.export(node.right.left), e.export(node.right.right)
+		}
+		return ternary
+	}
+	if node.left == nil {
+		return &Unary{span: s, Op: node.operator, X: e.export(node.right)}
+	}
+	return &Binary{span: s, Op: node.operator, X: e.export(node.left), Y: e.export(node.right)}
+}
+
+func (e exporter) exportList(nodes []*astNode) []Node {
+	list := make([]Node, len(nodes))
+	for i, n := range nodes {
+		list[i] = e.export(n)
+	}
+	return list
+}
+
+// path returns the variable path[0] followed by selectors of the other parts,
+// written from pos as in a.b.c
+func (e exporter) path(path []string, pos Position) Node {
+	end := advance(pos, path[0])
+	var x Node = &Variable{span: span{pos: pos, end: end}, Name: path[0]}
+	for _, part := range path[1:] {
+		end = advance(end, "."+part)
+		x = &Selector{span: span{pos: pos, end: end}, X: x, Field: part}
+	}
+	return x
+}
+
+// segments returns x followed by the selectors and indexes of rightList,
+// the first selector is optional when the segments follow ?.
+func (e exporter) segments(x Node, rightList []*astNode, optional bool) Node {
+	for _, seg := range rightList {
+		if seg.operator != ACCESSOR {
+			x = &Index{span: span{pos: x.Pos(), end: e.closing(seg.end, ']')}, X: x, Index: e.export(seg)}
+			continue
+		}
+		end := seg.pos
+		for _, part := range seg.path {
+			// the parts following ?. are not preceded by a dot
+			if optional {
+				end = advance(end, part)
+			} else {
+				end = advance(end, "."+part)
+			}
+			x = &Selector{span: span{pos: x.Pos(), end: end}, X: x, Field: part, Optional: optional}
+			optional = false
+		}
+	}
+	return x
+}
+
+// closing returns the position following the closing character if it is the next one after pos in the input,
+// or pos when it is not, such as for the index of a[0] b
+func (e exporter) closing(pos Position, closing byte) Position {
+	for end := pos; end.Offset >= 0 && end.Offset < len(e.input); {
+		c := e.input[end.Offset]
+		if c != closing && c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			break
+		}
+		end = advance(end, e.input[end.Offset:end.Offset+1])
+		if c == closing {
+			return end
+		}
+	}
+	return pos
+}
+
+// advance returns the position following s written from pos
+func advance(pos Position, s string) Position {
+	for _, r := range s {
+		if r == '\n' {
+			pos.Line, pos.Column = pos.Line+1, 1
+		} else {
+			pos.Column++
+		}
+		pos.Offset += utf8.RuneLen(r)
+	}
+	return pos
+}
+
+// copyValue copies the arrays of a constant, so that they are never modified through the public tree
+func copyValue(value interface{}) interface{} {
+	elems, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	res := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		res[i] = copyValue(elem)
+	}
+	return res
+}
+
+// Visitor visits the nodes of a syntax tree walked by Walk,
+// the children of node are visited with w unless it is nil
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree from node in depth-first order, as go/ast does: it calls v.Visit(node),
+// then walks through the children of node with the visitor w returned, followed by a call of w.Visit(nil)
+func Walk(v Visitor, node Node) {
+	if node == nil {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Selector:
+		Walk(v, n.X)
+	case *Index:
+		Walk(v, n.X)
+		Walk(v, n.Index)
+	case *Unary:
+		Walk(v, n.X)
+	case *Binary:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+	case *Ternary:
+		Walk(v, n.Cond)
+		Walk(v, n.Then)
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+	case *Call:
+		if n.Receiver != nil {
+			Walk(v, n.Receiver)
+		}
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+	case *Array:
+		for _, elem := range n.Elems {
+			Walk(v, elem)
+		}
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree from node in depth-first order, it calls f(node),
+// then walks through the children of node if f returns true, followed by a call of f(nil)
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
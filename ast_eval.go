@@ -1,127 +1,297 @@
 package goexpr
 
-import "fmt"
-
-const rightShortCircuit int = 0
-
-var ternaryShortCircuit interface{}
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 type Expr struct {
 	tokens  []LexerToken
 	astNode *astNode
+	program *program
 	input   string
+	fields  fieldNaming
+	limits  *Limits
+	typ     *Type // type of the values, inferred from the schema
 }
 
-func NewExpr(expr string) (res *Expr, err error) {
+func NewExpr(expr string, opts ...Option) (res *Expr, err error) {
+	return NewExprWithFunctions(expr, nil, opts...)
+}
+
+// NewExprWithFunctions parses the expression like NewExpr,
+// functions can be called by their name within the expression, e.g. max(a, b)
+func NewExprWithFunctions(expr string, functions map[string]ExprFunc, opts ...Option) (res *Expr, err error) {
+	options := newOptions(opts)
 	res = &Expr{
-		input: expr,
+		input:  expr,
+		fields: options.fields,
+		limits: options.limits,
+	}
+	if options.limits != nil {
+		if err = options.limits.checkInput(expr); err != nil {
+			return nil, withInput(err, expr)
+		}
 	}
 	res.tokens, err = lexerScan(expr)
 	if err != nil {
-		return nil, err
+		return nil, withInput(err, expr)
 	}
-	res.astNode, err = parseAST(res.tokens)
+	res.astNode, err = parseAST(res.tokens, options.allFunctions(functions), options.limits)
 	if err != nil {
-		return nil, err
+		return nil, withInput(err, expr)
+	}
+	if err = res.check(options); err != nil {
+		return nil, withInput(err, expr)
 	}
+	if options.optimize {
+		if res.astNode, err = optimize(res.astNode, options.limits); err != nil {
+			return nil, withInput(err, expr)
+		}
+	}
+	res.program = compile(res.astNode)
 	return res, nil
 }
 
+// check checks the tree of the expression against the limits and the schema of options, if any
+func (expr *Expr) check(options *options) (err error) {
+	if options.limits != nil {
+		if err = options.limits.checkTree(expr.astNode); err != nil {
+			return err
+		}
+	}
+	if options.schema != nil {
+		if expr.typ, err = checkTypes(expr.astNode, options.schema, options.fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalContext holds the state of a single evaluation, so that one Expr
+// can be evaluated by many goroutines at the same time
+type evalContext struct {
+	params  parameters
+	fields  fieldNaming
+	context context.Context
+	done    <-chan struct{} // done channel of context, nil if it is never done
+	limits  *Limits
+	tracer  *tracer // records the evaluation of every node, only for EvalTrace
+}
+
+// interrupted returns an error wrapping the error of the context once it is done
+func (ctx *evalContext) interrupted() error {
+	if ctx.done == nil {
+		return nil
+	}
+	select {
+	case <-ctx.done:
+		err := ctx.context.Err()
+		return &Error{
+			Msg: fmt.Sprintf("evaluation interrupted: %v", err),
+			Err: err,
+		}
+	default:
+		return nil
+	}
+}
+
+// Eval evaluates the expression with the given parameters,
+// it is safe to call Eval on the same Expr from multiple goroutines
 func (expr *Expr) Eval(params map[string]interface{}) (interface{}, error) {
+	return expr.run(context.Background(), MapParameters(params))
+}
+
+// EvalWith evaluates the expression with the parameters resolved by params,
+// such as values loaded lazily from a database or a feature store
+func (expr *Expr) EvalWith(params Parameters) (interface{}, error) {
+	return expr.EvalContext(context.Background(), params)
+}
+
+// EvalContext evaluates the expression like EvalWith, the evaluation stops with an error
+// wrapping ctx.Err() as soon as ctx is done. ctx is given to the functions registered with
+// WithContextFunctions, and to params if they implement ContextParameters
+func (expr *Expr) EvalContext(ctx context.Context, params Parameters) (interface{}, error) {
+	if params == nil {
+		return expr.run(ctx, MapParameters(nil))
+	}
+	if p, ok := params.(parameters); ok {
+		return expr.run(ctx, p)
+	}
+	return expr.run(ctx, resolverParameters{resolver: params})
+}
+
+// EvalStruct evaluates the expression with the exported fields of the struct v as parameters,
+// v may also be a pointer to a struct. the fields of each struct type are looked up by their name
+// only once, so that repeated evaluations do not pay for it
+func (expr *Expr) EvalStruct(v interface{}) (interface{}, error) {
+	params, err := newStructParameters(v, expr.fields)
+	if err != nil {
+		return nil, withInput(err, expr.input)
+	}
+	return expr.run(context.Background(), params)
+}
+
+func (expr *Expr) run(goctx context.Context, params parameters) (interface{}, error) {
 	if expr.astNode == nil {
 		return nil, nil
 	}
-	value, err := expr.eval(expr.astNode, params)
-	ternaryShortCircuit = nil
-	return value, err
+	ctx := &evalContext{
+		params:  params,
+		fields:  expr.fields,
+		context: goctx,
+		done:    goctx.Done(),
+		limits:  expr.limits,
+	}
+	res, err := expr.program.run(ctx)
+	if err != nil {
+		return nil, withInput(err, expr.input)
+	}
+	return res, nil
+}
+
+// eval walks the tree from node. the tree walker is the reference implementation of the evaluation:
+// the compiled program run by Eval must give the same results and errors, which TestProgramMatchesTreeWalker
+// checks for every operator, limit and interruption. it is used by EvalTrace, which records
+// the evaluation of every node when ctx has a tracer, and counts a step per node rather than per instruction
+func (expr *Expr) eval(node *astNode, ctx *evalContext) (interface{}, error) {
+	var trace *Trace
+	if ctx.tracer != nil {
+		var err error
+		if trace, err = ctx.tracer.enter(node, ctx.limits); err != nil {
+			return nil, err
+		}
+	}
+	res, err := expr.evalNode(node, ctx)
+	if err == nil && ctx.limits != nil && !node.constant && !node.isParam() && node.operator != TERNARY_IF {
+		// the values produced by the node are checked as the compiled program does
+		if err = ctx.limits.checkValue(res); err != nil {
+			res, err = nil, wrapError(err, node.pos, node.end)
+		}
+	}
+	if ctx.tracer != nil {
+		ctx.tracer.leave(trace, res, err)
+	}
+	return res, err
 }
 
-func (expr *Expr) eval(node *astNode, params map[string]interface{}) (interface{}, error) {
+func (expr *Expr) evalNode(node *astNode, ctx *evalContext) (interface{}, error) {
 	var (
 		left, right interface{}
 		rightList   []interface{}
 		err         error
 	)
 
+	if err = ctx.interrupted(); err != nil {
+		return nil, wrapError(err, node.pos, node.end)
+	}
+
 	if node.left != nil {
-		left, err = expr.eval(node.left, params)
+		left, err = expr.eval(node.left, ctx)
 		if err != nil {
-			return nil, err
+			if !node.operator.isNilSafe() || !node.left.isNilSafeOperand() || !errors.Is(err, ErrUnknownParameter) {
+				return nil, err
+			}
+			left = nil
 		}
 	}
-	if node.operator.isTernary() && ternaryShortCircuit != nil {
-		return ternaryShortCircuit, nil
-	}
-	if !node.operator.isTernary() && ternaryShortCircuit != nil {
-		ternaryShortCircuit = nil
-	}
 
 	if node.operator.isShortCircuit() {
 		switch node.operator {
-		case AND:
+		case LAND:
 			if left == false {
-				return false, nil
+				return _false, nil
 			}
-		case OR:
+		case LOR:
 			if left == true {
-				return true, nil
+				return _true, nil
 			}
 		case TERNARY_IF:
-			if left == false {
-				right = rightShortCircuit
-			}
-		case TERNARY_ELSE:
-			if left != nil {
-				ternaryShortCircuit = left
-				right = rightShortCircuit
+			return expr.evalTernary(node, left, ctx)
+		case COALESCE:
+			if !isNil(left) {
+				return left, nil
 			}
 		}
 	}
 
-	if right != rightShortCircuit {
-		if node.right != nil {
-			right, err = expr.eval(node.right, params)
+	if node.right != nil {
+		right, err = expr.eval(node.right, ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else if node.rightList != nil {
+		rightList = make([]interface{}, len(node.rightList))
+		for i, r := range node.rightList {
+			right, err = expr.eval(r, ctx)
 			if err != nil {
 				return nil, err
 			}
-		} else if node.rightList != nil {
-			rightList = make([]interface{}, len(node.rightList))
-			for i, r := range node.rightList {
-				right, err = expr.eval(r, params)
-				if err != nil {
-					return nil, err
-				}
-				rightList[i] = right
-			}
+			rightList[i] = right
 		}
 	}
 
-	if !node.operator.isTernary() && ternaryShortCircuit != nil {
-		ternaryShortCircuit = nil
-	}
-
 	if err = typeCheck(node, left, right); err != nil {
-		return nil, err
+		return nil, wrapError(err, node.pos, node.end)
 	}
 
+	var res interface{}
 	if rightList != nil {
-		return node.calculator(left, rightList, params)
+		res, err = node.calculator(left, rightList, *ctx)
+	} else {
+		res, err = node.calculator(left, right, *ctx)
+	}
+	if err != nil {
+		return nil, wrapError(err, node.pos, node.end)
 	}
-	return node.calculator(left, right, params)
+	return res, nil
+}
+
+// evalTernary evaluates only the branch chosen by cond,
+// the right of a TERNARY_IF node is either the only branch or a TERNARY_ELSE node holding both
+func (expr *Expr) evalTernary(node *astNode, cond interface{}, ctx *evalContext) (interface{}, error) {
+	if err := typeCheck(node, cond, nil); err != nil {
+		return nil, wrapError(err, node.left.pos, node.left.end)
+	}
+
+	branch := node.right
+	if branch.operator == TERNARY_ELSE {
+		if cond == true {
+			return expr.eval(branch.left, ctx)
+		}
+		return expr.eval(branch.right, ctx)
+	}
+	if cond == true {
+		return expr.eval(branch, ctx)
+	}
+	return nil, nil
 }
 
 func typeCheck(node *astNode, left, right interface{}) error {
 	if node.bothCheck == nil {
 		if node.leftCheck != nil && !node.leftCheck(left) {
-			return fmt.Errorf(node.err, left, node.operator)
+			return newTypeMismatch(node, left, left, right)
 		}
 		if node.rightCheck != nil && !node.rightCheck(right) {
-			return fmt.Errorf(node.err, right, node.operator)
+			return newTypeMismatch(node, right, left, right)
 		}
 	} else {
 		if !node.bothCheck(left, right) {
-			return fmt.Errorf(node.err, left, node.operator)
+			return newTypeMismatch(node, left, left, right)
 		}
 	}
 	return nil
 }
+
+// newTypeMismatch reports the value which failed the type check of node,
+// only the checked operands are reported: the operand of prefix operators, the condition of ternary operators
+func newTypeMismatch(node *astNode, value, left, right interface{}) error {
+	operands := []interface{}{left, right}
+	if node.bothCheck == nil && node.leftCheck == nil {
+		operands = []interface{}{right}
+	} else if node.bothCheck == nil && node.rightCheck == nil {
+		operands = []interface{}{left}
+	}
+	return newEvalError(ErrTypeMismatch, node.operator, operands, node.err, value, node.operator)
+}
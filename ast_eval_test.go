@@ -1,16 +1,23 @@
 package goexpr
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type ParseAstTest struct {
-	Name   string
-	Input  string
-	Params map[string]interface{}
-	Wanted interface{}
+	Name      string
+	Input     string
+	Params    map[string]interface{}
+	Functions map[string]ExprFunc
+	Wanted    interface{}
 }
 
 type Param struct {
@@ -95,7 +102,7 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Simple ADD",
 			Input:  "1 + 2",
-			Wanted: 3.0,
+			Wanted: int64(3),
 		},
 		{
 			Name:   "Simple ADD",
@@ -125,37 +132,37 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Simple SUB",
 			Input:  "7 - 5",
-			Wanted: 2.0,
+			Wanted: int64(2),
 		},
 		{
 			Name:   "Simple SUB",
 			Input:  "55 - 77",
-			Wanted: -22.0,
+			Wanted: int64(-22),
 		},
 		{
 			Name:   "Simple MUL",
 			Input:  "55 * 77",
-			Wanted: 4235.0,
+			Wanted: int64(4235),
 		},
 		{
 			Name:   "Simple QUO",
 			Input:  "55 / 11",
-			Wanted: 5.0,
+			Wanted: int64(5),
 		},
 		{
 			Name:   "Simple REM",
 			Input:  "55 % 10",
-			Wanted: 5.0,
+			Wanted: int64(5),
 		},
 		{
 			Name:   "Simple REM",
 			Input:  "55 % 11",
-			Wanted: 0.0,
+			Wanted: int64(0),
 		},
 		{
 			Name:   "Multi ADD",
 			Input:  "1 + 2 + 30",
-			Wanted: 33.0,
+			Wanted: int64(33),
 		},
 		{
 			Name:   "Multi ADD",
@@ -165,117 +172,147 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Multi SUB",
 			Input:  "1 - 2 - 30",
-			Wanted: -31.0,
+			Wanted: int64(-31),
 		},
 		{
 			Name:   "Multi OPERATOR",
 			Input:  "2 * -2",
-			Wanted: -4.0,
+			Wanted: int64(-4),
 		},
 		{
 			Name:   "Multi OPERATOR",
 			Input:  "1 + 2 - 3 + 4 - 5",
-			Wanted: -1.0,
+			Wanted: int64(-1),
 		},
 		{
 			Name:   "Multi OPERATOR",
 			Input:  "1 - 2 + 3 - 4 + 5",
-			Wanted: 3.0,
+			Wanted: int64(3),
 		},
 		{
 			Name:   "Multi OPERATOR",
 			Input:  "1 + 2 * 3 + 4 - 5",
-			Wanted: 6.0,
+			Wanted: int64(6),
 		},
 		{
 			Name:   "Multi OPERATOR",
 			Input:  "1 / 2 * 3 / 4 * 5",
+			Wanted: int64(0),
+		},
+		{
+			Name:   "Multi OPERATOR FLOAT",
+			Input:  "1.0 / 2 * 3 / 4 * 5",
 			Wanted: 1.875,
 		},
 		{
 			Name:   "Multi OPERATOR",
 			Input:  "1 / 2 * 3 + 4 * 5",
+			Wanted: int64(20),
+		},
+		{
+			Name:   "Multi OPERATOR FLOAT",
+			Input:  "1.0 / 2 * 3 + 4 * 5",
 			Wanted: 21.5,
 		},
 		{
 			Name:   "Multi OPERATOR",
 			Input:  "1 / 2 * 3 + 4 * 5 + 6 % 7",
+			Wanted: int64(26),
+		},
+		{
+			Name:   "Multi OPERATOR FLOAT",
+			Input:  "1.0 / 2 * 3 + 4 * 5 + 6 % 7",
 			Wanted: 27.5,
 		},
 		{
 			Name:   "Multi OPERATOR",
 			Input:  "1 * 2 / 4 * 3",
+			Wanted: int64(0),
+		},
+		{
+			Name:   "Multi OPERATOR FLOAT",
+			Input:  "1.0 * 2 / 4 * 3",
 			Wanted: 1.5,
 		},
 		{
 			Name:   "PAREN",
 			Input:  "1 / 2 * (3 + 4) * 5",
+			Wanted: int64(0),
+		},
+		{
+			Name:   "PAREN FLOAT",
+			Input:  "1.0 / 2 * (3 + 4) * 5",
 			Wanted: 17.5,
 		},
 		{
 			Name:   "PAREN RECURSIVE",
 			Input:  "1 / ( 2 * (3 + 4)) * 7",
+			Wanted: int64(0),
+		},
+		{
+			Name:   "PAREN RECURSIVE FLOAT",
+			Input:  "1.0 / ( 2 * (3 + 4)) * 7",
 			Wanted: 0.5,
 		},
 		{
 			Name:   "PAREN RECURSIVE",
 			Input:  "1 * ( 2 * (3 + 4)) % 7",
-			Wanted: 0.0,
+			Wanted: int64(0),
 		},
 		{
 			Name:   "Simple PREFIX",
 			Input:  "-1",
-			Wanted: -1.0,
+			Wanted: int64(-1),
 		},
 		{
 			Name:   "NEG PREFIX",
 			Input:  "-(1 * ( 2 * (3 + 4)) % 7)",
-			Wanted: 0.0,
+			Wanted: int64(0),
 		},
 		{
 			Name:   "Simple SHL",
 			Input:  "2 << 1",
-			Wanted: 4.0,
+			Wanted: int64(4),
 		},
 		{
 			Name:   "Simple SHR",
 			Input:  "2 >> 1",
-			Wanted: 1.0,
+			Wanted: int64(1),
 		},
 		{
 			Name:   "Simple AND",
 			Input:  "71 & 23",
-			Wanted: 7.0,
+			Wanted: int64(7),
 		},
 		{
 			Name:   "Simple OR",
 			Input:  "71 | 23",
-			Wanted: 87.0,
+			Wanted: int64(87),
 		},
 		{
 			Name:   "Simple XOR",
 			Input:  "71 ^ 23",
-			Wanted: 80.0,
+			Wanted: int64(80),
 		},
 		{
 			Name:   "Multi BITWISE",
 			Input:  "71 ^ (23 | (71 & 23))",
-			Wanted: 80.0,
+			Wanted: int64(80),
 		},
 		{
 			Name:   "Multi BIT",
 			Input:  "1 << 2 & 4",
-			Wanted: 4.0,
+			Wanted: int64(4),
 		},
 		{
 			Name:   "Multi BIT",
 			Input:  "1 << 2 & 15",
-			Wanted: 4.0,
+			Wanted: int64(4),
 		},
 		{
 			Name:   "Multi BIT",
 			Input:  "1 << 2 | 11",
-			Wanted: 15.0,
+			Wanted: int64(15),
 		},
 		{
 			Name:   "Simple COMPARATOR",
@@ -406,7 +443,7 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Multi OPERATOR",
 			Input:  "4 + 3 << 2 * 2",
-			Wanted: 112.0,
+			Wanted: int64(112),
 		},
 		{
 			Name:   "Multi OPERATOR",
@@ -421,7 +458,7 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Multi OPERATOR",
 			Input:  "2 * -2",
-			Wanted: -4.0,
+			Wanted: int64(-4),
 		},
 		{
 			Name:   "Multi OPERATOR",
@@ -461,7 +498,7 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Simple TERNARY",
 			Input:  "1 < 2 ? 3",
-			Wanted: 3.0,
+			Wanted: int64(3),
 		},
 		{
 			Name:   "Simple TERNARY",
@@ -471,17 +508,17 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Multi TERNARY",
 			Input:  "1 > 2 ? 3 : 4",
-			Wanted: 4.0,
+			Wanted: int64(4),
 		},
 		{
 			Name:   "Multi TERNARY",
 			Input:  "1 < 2 ? 3 : 4",
-			Wanted: 3.0,
+			Wanted: int64(3),
 		},
 		{
 			Name:   "Multi TERNARY",
 			Input:  "(3.0 * 2 - 3 % 2 > 4) ? (1010 / 5) : 4",
-			Wanted: 202.0,
+			Wanted: int64(202),
 		},
 		{
 			Name:   "Multi TERNARY",
@@ -496,7 +533,7 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Multi TERNARY",
 			Input:  "1 != 2 ? 3 : (4 == 5 ? 6 : 7)",
-			Wanted: 3.0,
+			Wanted: int64(3),
 		},
 		{
 			Name:   "Multi TERNARY",
@@ -511,17 +548,17 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Multi TERNARY",
 			Input:  "1 > 2 ? 3 : true ? 6 : 7 <= 8 ? 9 : 10",
-			Wanted: 6.0,
+			Wanted: int64(6),
 		},
 		{
 			Name:   "Multi TERNARY",
 			Input:  "1 > 2 ? 3 : 4 > 5 ? 6 : 7 <= 8 ? 9 : 10",
-			Wanted: 9.0,
+			Wanted: int64(9),
 		},
 		{
 			Name:   "Multi TERNARY",
 			Input:  "1 > 2 ? 3 : 4 > 5 ? 6 : 7 == 8 ? 9 : 10",
-			Wanted: 10.0,
+			Wanted: int64(10),
 		},
 		{
 			Name:   "Multi TERNARY",
@@ -531,22 +568,22 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Multi TERNARY",
 			Input:  "1 == 2 ? 3 : 4 != 5 ? 6 : 7",
-			Wanted: 6.0,
+			Wanted: int64(6),
 		},
 		{
 			Name:   "Multi TERNARY",
 			Input:  "1 != 2 ? 3 : 4 == 5 ? 6 : 7",
-			Wanted: 3.0,
+			Wanted: int64(3),
 		},
 		{
 			Name:   "Multi TERNARY",
 			Input:  `(1 != 2 ? true : 4 == 5 ? 6 : 7) ? (1 == 2 ? 3 : 4 != 5 ? 6 : 7) : "abc"`,
-			Wanted: 6.0,
+			Wanted: int64(6),
 		},
 		{
 			Name:   "Multi TERNARY",
 			Input:  "(1 != 2 ? 3 : 4 == 5 ? 6 : 7) + (1 == 2 ? 3 : 4 != 5 ? 6 : 7)",
-			Wanted: 9.0,
+			Wanted: int64(9),
 		},
 		{
 			Name:   "Multi TERNARY",
@@ -556,7 +593,7 @@ func TestParseAst(t *testing.T) {
 		{
 			Name:   "Multi TERNARY",
 			Input:  `(1 != 2 ? true : 4 == 5 ? 6 : 7) ? (1 == 2 ? 3 : 4 != 5 ? 6 : 7) : "abc"`,
-			Wanted: 6.0,
+			Wanted: int64(6),
 		},
 	}
 	runParseAstTests(parseAstTests, t)
@@ -670,6 +707,12 @@ func TestParseAstWithParams(t *testing.T) {
 			Params: m,
 			Wanted: "rulengine",
 		},
+		{
+			Name:   "Selector Bracket Float",
+			Input:  `param.Array[1.0]`,
+			Params: m,
+			Wanted: "rulengine",
+		},
 		{
 			Name:   "Selector Bracket",
 			Input:  `param.Map["key_str"]`,
@@ -716,6 +759,449 @@ func TestParseAstWithParams(t *testing.T) {
 
 	runParseAstTests(parseAstTests, t)
 }
+
+func TestParseAstNumericTower(t *testing.T) {
+	params := map[string]interface{}{
+		"id":    int64(1<<53 + 1),
+		"count": uint32(3),
+		"ratio": float32(0.5),
+		"json":  7.0,
+		"big":   uint64(math.MaxUint64),
+	}
+	parseAstTests := []ParseAstTest{
+		{
+			Name:   "Int Literal Precision",
+			Input:  "9007199254740993 + 0",
+			Wanted: int64(9007199254740993),
+		},
+		{
+			Name:   "Int Param Precision",
+			Input:  "id + 1",
+			Params: params,
+			Wanted: int64(1<<53 + 2),
+		},
+		{
+			Name:   "Int Param Compare",
+			Input:  "id > 9007199254740992",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Int Float Promotion",
+			Input:  "1 + 0.5",
+			Wanted: 1.5,
+		},
+		{
+			Name:   "Int Float Param Promotion",
+			Input:  "count * ratio",
+			Params: params,
+			Wanted: 1.5,
+		},
+		{
+			Name:   "Int Float EQ",
+			Input:  "1 == 1.0",
+			Wanted: true,
+		},
+		{
+			Name:   "Int Float NEQ",
+			Input:  "json != 7",
+			Params: params,
+			Wanted: false,
+		},
+		{
+			Name:   "Int Float Compare",
+			Input:  "2 > 1.5",
+			Wanted: true,
+		},
+		{
+			Name:   "Int QUO",
+			Input:  "7 / 2",
+			Wanted: int64(3),
+		},
+		{
+			Name:   "Negative Int QUO",
+			Input:  "-7 / 2",
+			Wanted: int64(-3),
+		},
+		{
+			Name:   "Float QUO",
+			Input:  "7.0 / 2",
+			Wanted: 3.5,
+		},
+		{
+			Name:   "Int REM",
+			Input:  "7 % -2",
+			Wanted: int64(1),
+		},
+		{
+			Name:   "Large AND",
+			Input:  "id & 1",
+			Params: params,
+			Wanted: int64(1),
+		},
+		{
+			Name:   "Large SHL",
+			Input:  "1 << 62",
+			Wanted: int64(1 << 62),
+		},
+		{
+			Name:   "SHL To MinInt64",
+			Input:  "-1 << 63",
+			Wanted: int64(math.MinInt64),
+		},
+		{
+			Name:   "SHR Beyond Width",
+			Input:  "-8 >> 70",
+			Wanted: int64(-1),
+		},
+		{
+			Name:   "Integral Float AND",
+			Input:  "json & 3",
+			Params: params,
+			Wanted: int64(3),
+		},
+		{
+			Name:   "Uint64 Overflowing Int64",
+			Input:  "big",
+			Params: params,
+			Wanted: uint64(math.MaxUint64),
+		},
+	}
+	runParseAstTests(parseAstTests, t)
+}
+
+func TestNumericErrors(t *testing.T) {
+	params := map[string]interface{}{
+		"max":  int64(math.MaxInt64),
+		"min":  int64(math.MinInt64),
+		"big":  uint64(math.MaxUint64),
+		"half": 0.5,
+	}
+	inputs := []string{
+		"9223372036854775807 + 1",
+		"min - 1",
+		"max * 2",
+		"min / -1",
+		"-min",
+		"1 / 0",
+		"1 % 0",
+		"half & 1",
+		"1 << (0 - 1)",
+		"1 >> (0 - 1)",
+		"1 << 63",
+		"1 << 64",
+		"3 << 62",
+		"max << 1",
+		"big + 1",
+	}
+	for _, input := range inputs {
+		expr, err := NewExpr(input)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", input, err)
+			continue
+		}
+		if _, err = expr.Eval(params); err == nil {
+			t.Errorf("input %s should fail to eval", input)
+		}
+	}
+
+	// an integer literal beyond the int64 range is a float64
+	expr, err := NewExpr("9223372036854775808 + 1")
+	if err != nil {
+		t.Fatalf("out of range integer literal failed to parse: %s", err)
+	}
+	if res, err := expr.Eval(nil); err != nil || res != 9223372036854775809.0 {
+		t.Errorf("out of range integer literal: result '%v' (error %v) should be a float64", res, err)
+	}
+}
+
+var testFunctions = map[string]ExprFunc{
+	"max": func(args ...interface{}) (interface{}, error) {
+		res := toFloat64(args[0])
+		for _, arg := range args[1:] {
+			res = math.Max(res, toFloat64(arg))
+		}
+		return res, nil
+	},
+	"len": FixedArity(1, func(args ...interface{}) (interface{}, error) {
+		return len(args[0].(string)), nil
+	}),
+	"now": FixedArity(0, func(args ...interface{}) (interface{}, error) {
+		return 1656806400, nil
+	}),
+	"concat": func(args ...interface{}) (interface{}, error) {
+		return fmt.Sprint(args...), nil
+	},
+	"fail": func(args ...interface{}) (interface{}, error) {
+		return nil, errTestFunction
+	},
+}
+
+var errTestFunction = errors.New("test function failed")
+
+func TestParseAstWithFunctions(t *testing.T) {
+	parseAstTests := []ParseAstTest{
+		{
+			Name:      "No Argument",
+			Input:     "now()",
+			Functions: testFunctions,
+			Wanted:    int64(1656806400),
+		},
+		{
+			Name:      "Single Argument",
+			Input:     `len("abc")`,
+			Functions: testFunctions,
+			Wanted:    int64(3),
+		},
+		{
+			Name:      "Multi Arguments",
+			Input:     "max(1, 3, 2)",
+			Functions: testFunctions,
+			Wanted:    3.0,
+		},
+		{
+			Name:      "Negative Arguments",
+			Input:     "max(-1,-3)",
+			Functions: testFunctions,
+			Wanted:    -1.0,
+		},
+		{
+			Name:      "Expression Arguments",
+			Input:     "max(1 + 2 * 3, (4 - 1 - 1) * 5)",
+			Functions: testFunctions,
+			Wanted:    10.0,
+		},
+		{
+			Name:      "Nested Functions",
+			Input:     `max(len("abcd"), max(1, 2)) > 3`,
+			Functions: testFunctions,
+			Wanted:    true,
+		},
+		{
+			Name:      "Function In Operation",
+			Input:     "1 + max(a, b) * 2",
+			Params:    map[string]interface{}{"a": 3, "b": 4},
+			Functions: testFunctions,
+			Wanted:    9.0,
+		},
+		{
+			Name:      "Function With Ternary",
+			Input:     `max(a, b) > 3 ? concat("x", a) : "y"`,
+			Params:    map[string]interface{}{"a": 3, "b": 4},
+			Functions: testFunctions,
+			Wanted:    "x3",
+		},
+		{
+			Name:      "Function With Selector",
+			Input:     `len(user.name)`,
+			Params:    map[string]interface{}{"user": map[string]interface{}{"name": "leon"}},
+			Functions: testFunctions,
+			Wanted:    int64(4),
+		},
+	}
+	runParseAstTests(parseAstTests, t)
+}
+
+func TestFunctionErrors(t *testing.T) {
+	if _, err := NewExprWithFunctions("min(1, 2)", testFunctions); err == nil {
+		t.Errorf("undefined function should fail to parse")
+	}
+	if _, err := NewExpr("max(1, 2)"); err == nil {
+		t.Errorf("function without registry should fail to parse")
+	}
+	if _, err := NewExprWithFunctions("max(1 2)", testFunctions); err == nil {
+		t.Errorf("arguments without comma should fail to parse")
+	}
+
+	expr, err := NewExprWithFunctions(`len("a", "b")`, testFunctions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = expr.Eval(nil); err == nil {
+		t.Errorf("wrong arity should fail to eval")
+	}
+
+	expr, err = NewExprWithFunctions("fail() || true", testFunctions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = expr.Eval(nil); !errors.Is(err, errTestFunction) {
+		t.Errorf("function error should be propagated, got %v", err)
+	}
+}
+
+type testUser struct {
+	First   string
+	Last    string
+	Age     int
+	Friends []*testUser
+}
+
+func (u testUser) FullName() string {
+	return u.First + " " + u.Last
+}
+
+func (u *testUser) IsAdult() bool {
+	return u.Age >= 18
+}
+
+func (u testUser) Greet(greeting string) string {
+	return greeting + ", " + u.First
+}
+
+func (u testUser) Join(sep string, parts ...string) string {
+	return u.First + sep + strings.Join(parts, sep)
+}
+
+func (u testUser) AgeIn(years int) int {
+	return u.Age + years
+}
+
+func (u testUser) Shift(n int8) int8 {
+	return n
+}
+
+func (u testUser) Repeat(n uint) uint {
+	return n
+}
+
+func (u testUser) BestFriend() (*testUser, error) {
+	if len(u.Friends) == 0 {
+		return nil, errNoFriend
+	}
+	return u.Friends[0], nil
+}
+
+var errNoFriend = errors.New("no friend")
+
+func TestParseAstWithMethods(t *testing.T) {
+	bob := &testUser{First: "Bob", Last: "Lee", Age: 17}
+	alice := testUser{First: "Alice", Last: "Smith", Age: 30, Friends: []*testUser{bob}}
+	params := map[string]interface{}{
+		"alice": alice,
+		"bob":   bob,
+		"team":  map[string]interface{}{"leader": alice, "members": []interface{}{alice, bob}},
+	}
+
+	parseAstTests := []ParseAstTest{
+		{
+			Name:   "Value Receiver",
+			Input:  "alice.FullName()",
+			Params: params,
+			Wanted: "Alice Smith",
+		},
+		{
+			Name:   "Pointer Receiver On Value",
+			Input:  "alice.IsAdult()",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Pointer Receiver On Pointer",
+			Input:  "bob.IsAdult()",
+			Params: params,
+			Wanted: false,
+		},
+		{
+			Name:   "Method With Argument",
+			Input:  `alice.Greet("Hello")`,
+			Params: params,
+			Wanted: "Hello, Alice",
+		},
+		{
+			Name:   "Variadic Method",
+			Input:  `alice.Join("-", "a", "b")`,
+			Params: params,
+			Wanted: "Alice-a-b",
+		},
+		{
+			Name:   "Variadic Method Without Variadic Arguments",
+			Input:  `alice.Join("-")`,
+			Params: params,
+			Wanted: "Alice-",
+		},
+		{
+			Name:   "Numeric Argument",
+			Input:  "alice.AgeIn(2 * 5) == 40",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Narrow Integer Argument",
+			Input:  "alice.Shift(-128) + alice.Repeat(7.0)",
+			Params: params,
+			Wanted: int64(-121),
+		},
+		{
+			Name:   "Nested Selector Receiver",
+			Input:  "team.leader.FullName()",
+			Params: params,
+			Wanted: "Alice Smith",
+		},
+		{
+			Name:   "Bracket Receiver",
+			Input:  "team.members[1].FullName()",
+			Params: params,
+			Wanted: "Bob Lee",
+		},
+		{
+			Name:   "Chained Methods",
+			Input:  "alice.BestFriend().FullName()",
+			Params: params,
+			Wanted: "Bob Lee",
+		},
+		{
+			Name:   "Selector After Method",
+			Input:  "alice.BestFriend().Age + 1",
+			Params: params,
+			Wanted: int64(18),
+		},
+		{
+			Name:   "Method In Expression",
+			Input:  `alice.IsAdult() && !bob.IsAdult() ? alice.FullName() : bob.FullName()`,
+			Params: params,
+			Wanted: "Alice Smith",
+		},
+	}
+	runParseAstTests(parseAstTests, t)
+}
+
+func TestMethodErrors(t *testing.T) {
+	params := map[string]interface{}{
+		"bob": &testUser{First: "Bob"},
+	}
+	tests := []struct {
+		input  string
+		wanted error
+	}{
+		{input: "bob.BestFriend()", wanted: errNoFriend},
+		{input: "bob.Unknown()"},
+		{input: "bob.Greet()"},
+		{input: "bob.Greet(1)"},
+		{input: "bob.AgeIn(1.5)", wanted: ErrTypeMismatch},
+		{input: "bob.Shift(300)", wanted: ErrTypeMismatch},
+		{input: "bob.Shift(-129)", wanted: ErrTypeMismatch},
+		{input: "bob.Shift(200.0)", wanted: ErrTypeMismatch},
+		{input: "bob.Repeat(-1)", wanted: ErrTypeMismatch},
+		{input: "bob.Repeat(-1.0)", wanted: ErrTypeMismatch},
+		{input: "bob.Repeat(100000000000000000000.0)", wanted: ErrTypeMismatch},
+		{input: "bob.AgeIn(10000000000000000000.0)", wanted: ErrTypeMismatch},
+	}
+	for _, test := range tests {
+		expr, err := NewExpr(test.input)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		_, err = expr.Eval(params)
+		if err == nil {
+			t.Errorf("input %s should fail to eval", test.input)
+		} else if test.wanted != nil && !errors.Is(err, test.wanted) {
+			t.Errorf("input %s: error %v should wrap %v", test.input, err, test.wanted)
+		}
+	}
+}
+
 func runParseAstTests(tests []ParseAstTest, test *testing.T) {
 
 	var expr *Expr
@@ -726,7 +1212,7 @@ func runParseAstTests(tests []ParseAstTest, test *testing.T) {
 
 	// Run the test cases.
 	for _, t := range tests {
-		expr, err = NewExpr(t.Input)
+		expr, err = NewExprWithFunctions(t.Input, t.Functions)
 
 		if err != nil {
 
@@ -753,3 +1239,798 @@ func runParseAstTests(tests []ParseAstTest, test *testing.T) {
 		}
 	}
 }
+
+func TestParseAstWithMembership(t *testing.T) {
+	params := map[string]interface{}{
+		"status": "trial",
+		"code":   201,
+		"codes":  []int{200, 201, 204},
+		"ids":    [2]uint8{1, 2},
+		"roles":  map[string]bool{"admin": true},
+		"flags":  map[int]string{3: "x"},
+	}
+	parseAstTests := []ParseAstTest{
+		{
+			Name:   "String In Literal Array",
+			Input:  `status in ["active", "trial"]`,
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Number In Literal Array",
+			Input:  "code in [200, 201, 204]",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Number Not In Literal Array",
+			Input:  "code not in [200, 204]",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Float In Integer Array",
+			Input:  "201.0 in [200, 201]",
+			Wanted: true,
+		},
+		{
+			Name:   "Negative In Literal Array",
+			Input:  "-1 in [0, -1]",
+			Wanted: true,
+		},
+		{
+			Name:   "Expression Elements",
+			Input:  "code in [code - 1, code + 1]",
+			Params: params,
+			Wanted: false,
+		},
+		{
+			Name:   "Empty Array",
+			Input:  "code in []",
+			Params: params,
+			Wanted: false,
+		},
+		{
+			Name:   "In Slice Parameter",
+			Input:  "204 in codes",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "In Array Parameter",
+			Input:  "3 not in ids",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "In Map Keys",
+			Input:  `"admin" in roles`,
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Not In Map Keys",
+			Input:  `"guest" not in roles`,
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Integer In Map Keys",
+			Input:  "3 in flags",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Fraction In Integer Map Keys",
+			Input:  "3.5 in flags",
+			Params: params,
+			Wanted: false,
+		},
+		{
+			Name:   "Membership Priority",
+			Input:  "code + 3 in codes == true && status in [\"trial\"]",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Array Equality",
+			Input:  "[1, 2] == [1, 2]",
+			Wanted: true,
+		},
+	}
+	runParseAstTests(parseAstTests, t)
+
+	expr, err := NewExpr(`[1, "a", [true]]`)
+	if err != nil {
+		t.Fatalf("failed to parse array literal: %s", err)
+	}
+	res, err := expr.Eval(nil)
+	wanted := []interface{}{int64(1), "a", []interface{}{true}}
+	if err != nil || !reflect.DeepEqual(res, wanted) {
+		t.Errorf("array literal: result '%v' (error %v) does not match wanted: '%v'", res, err, wanted)
+	}
+
+	expr, err = NewExpr("1 in code")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if _, err = expr.Eval(params); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("membership in a number should fail with a type mismatch, got %v", err)
+	}
+}
+
+func TestParseAstWithMatch(t *testing.T) {
+	params := map[string]interface{}{
+		"email":   "bob@example.com",
+		"pattern": "^bob@",
+	}
+	parseAstTests := []ParseAstTest{
+		{
+			Name:   "Match Literal Pattern",
+			Input:  `email =~ "@example[.]com$"`,
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Not Match Literal Pattern",
+			Input:  `email !~ "@example[.]org$"`,
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Match Raw String Pattern",
+			Input:  "email =~ `^\\w+@example\\.com$`",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Match Escaped Pattern",
+			Input:  `email !~ "\\.org$"`,
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Match Parameter Pattern",
+			Input:  "email =~ pattern",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Match Concatenated Pattern",
+			Input:  `email =~ "^" + "alice"`,
+			Params: params,
+			Wanted: false,
+		},
+		{
+			Name:   "Match Without Spaces",
+			Input:  `email=~"bob" && email!~"alice"`,
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Match In Clause",
+			Input:  `!(email =~ "^alice")`,
+			Params: params,
+			Wanted: true,
+		},
+	}
+	runParseAstTests(parseAstTests, t)
+}
+
+func TestMatchErrors(t *testing.T) {
+	_, err := NewExpr(`email =~ "a(b"`)
+	var exprErr *Error
+	if !errors.As(err, &exprErr) || !errors.Is(err, ErrSyntax) {
+		t.Fatalf("invalid literal pattern should fail to parse with a syntax error, got %v", err)
+	}
+	if exprErr.Pos.Column != 10 || exprErr.End.Column != 15 {
+		t.Errorf("invalid literal pattern should be located at columns 10-15, got %v-%v", exprErr.Pos, exprErr.End)
+	}
+
+	// patterns folded into a literal string are checked as well
+	for _, input := range []string{`email =~ ("a(b")`, `email !~ "a" + "(b"`} {
+		if _, err := NewExpr(input); !errors.Is(err, ErrSyntax) {
+			t.Errorf("input %s: invalid folded pattern should fail to parse with a syntax error, got %v", input, err)
+		}
+	}
+	expr, err := NewExpr(`email =~ "@" + "example"`)
+	if err != nil {
+		t.Fatalf("folded pattern failed to parse: %s", err)
+	}
+	if res, err := expr.Eval(map[string]interface{}{"email": "bob@example.com"}); err != nil || res != true {
+		t.Errorf("folded pattern: result '%v' (error %v) should be true", res, err)
+	}
+
+	params := map[string]interface{}{
+		"email":   "bob@example.com",
+		"pattern": "a(b",
+		"id":      1,
+	}
+	tests := []struct {
+		input  string
+		wanted error
+	}{
+		{input: "email =~ pattern"},
+		{input: `id =~ "1"`, wanted: ErrTypeMismatch},
+		{input: "email !~ id", wanted: ErrTypeMismatch},
+	}
+	for _, test := range tests {
+		expr, err := NewExpr(test.input)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		_, err = expr.Eval(params)
+		if err == nil {
+			t.Errorf("input %s should fail to eval", test.input)
+		} else if test.wanted != nil && !errors.Is(err, test.wanted) {
+			t.Errorf("input %s: error %v should be %v", test.input, err, test.wanted)
+		}
+	}
+}
+
+type testAddress struct {
+	City string
+}
+
+type testProfile struct {
+	Address *testAddress
+	Tags    map[string]string
+}
+
+func TestParseAstWithNil(t *testing.T) {
+	params := map[string]interface{}{
+		"user":    map[string]interface{}{"name": "Bob", "nickname": nil},
+		"profile": &testProfile{Address: &testAddress{City: "Paris"}},
+		"empty":   &testProfile{},
+		"none":    (*testProfile)(nil),
+		"orders":  []interface{}{map[string]interface{}{"id": 1}},
+	}
+	parseAstTests := []ParseAstTest{
+		{
+			Name:   "Nil Literal",
+			Input:  "nil == nil",
+			Wanted: true,
+		},
+		{
+			Name:   "Nil Not Equal Number",
+			Input:  "nil != 0",
+			Wanted: true,
+		},
+		{
+			Name:   "Nil Not Equal String",
+			Input:  `nil == ""`,
+			Wanted: false,
+		},
+		{
+			Name:   "Nil Parameter Equal Nil",
+			Input:  "user.nickname == nil",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Nil Pointer Equal Nil",
+			Input:  "empty.Address == nil && none == nil",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Nil Map Equal Nil",
+			Input:  "empty.Tags == nil",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Coalesce Nil Value",
+			Input:  "user.nickname ?? user.name",
+			Params: params,
+			Wanted: "Bob",
+		},
+		{
+			Name:   "Coalesce Missing Key",
+			Input:  "user.alias ?? user.name",
+			Params: params,
+			Wanted: "Bob",
+		},
+		{
+			Name:   "Coalesce Missing Parameter",
+			Input:  "limit ?? 10",
+			Params: params,
+			Wanted: int64(10),
+		},
+		{
+			Name:   "Coalesce Non Nil",
+			Input:  `user.name ?? "unknown"`,
+			Params: params,
+			Wanted: "Bob",
+		},
+		{
+			Name:   "Coalesce Chain",
+			Input:  "nil ?? user.nickname ?? 3",
+			Params: params,
+			Wanted: int64(3),
+		},
+		{
+			Name:   "Coalesce Priority",
+			Input:  "limit ?? 1 + 2",
+			Params: params,
+			Wanted: int64(3),
+		},
+		{
+			Name:   "Optional Chaining",
+			Input:  `profile?.Address?.City == "Paris"`,
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Optional Chaining Nil Pointer",
+			Input:  `empty?.Address?.City == "Paris"`,
+			Params: params,
+			Wanted: false,
+		},
+		{
+			Name:   "Optional Chaining Short Circuit",
+			Input:  "empty?.Address.City",
+			Params: params,
+			Wanted: nil,
+		},
+		{
+			Name:   "Optional Chaining Nil Parameter",
+			Input:  "none?.Address == nil",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Optional Chaining Missing Parameter",
+			Input:  "visitor?.name ?? \"guest\"",
+			Params: params,
+			Wanted: "guest",
+		},
+		{
+			Name:   "Optional Chaining After Index",
+			Input:  "orders[0]?.id + (orders[0]?.total ?? 0)",
+			Params: params,
+			Wanted: int64(1),
+		},
+	}
+	runParseAstTests(parseAstTests, t)
+}
+
+// a missing parameter is only taken as nil when it is the operand of ?? or ?.,
+// not when it is used by an operation on their left
+func TestNilErrors(t *testing.T) {
+	params := map[string]interface{}{"user": map[string]interface{}{"name": "Bob"}}
+	inputs := []string{
+		"missing + 1 ?? 3",
+		"(missing == 1) ?? false",
+		"-missing ?? 1",
+		"missing.Name()?.first ?? 1",
+		"user.name + missing ?? 1",
+	}
+	for _, opts := range [][]Option{nil, {WithoutOptimization()}} {
+		for _, input := range inputs {
+			expr, err := NewExpr(input, opts...)
+			if err != nil {
+				t.Errorf("input %s failed to parse: %s", input, err)
+				continue
+			}
+			if _, err = expr.Eval(params); !errors.Is(err, ErrUnknownParameter) {
+				t.Errorf("input %s: error %v should be an unknown parameter", input, err)
+			}
+			if _, _, err = expr.EvalTrace(params); !errors.Is(err, ErrUnknownParameter) {
+				t.Errorf("input %s: traced error %v should be an unknown parameter", input, err)
+			}
+		}
+	}
+
+	expr, err := NewExpr("(missing) ?? (user?.missing) ?? user.name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := expr.Eval(params); err != nil || res != "Bob" {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+}
+
+type testOrder struct {
+	testBase
+	Total    float64
+	Items    []string
+	Customer *testUser
+	Profile  testProfile
+	Paid     bool
+	note     string
+}
+
+func TestEvalStruct(t *testing.T) {
+	order := testOrder{
+		testBase: testBase{ID: 7, Name: "order"},
+		Total:    12.5,
+		Items:    []string{"book", "pen"},
+		Customer: &testUser{First: "Bob", Last: "Smith", Age: 20},
+		Profile:  testProfile{Address: &testAddress{City: "Paris"}},
+	}
+	tests := []struct {
+		input  string
+		params interface{}
+		wanted interface{}
+	}{
+		{"Total * 2", order, 25.0},
+		{"ID + 1", order, int64(8)},
+		{"Name", &order, "order"},
+		{"Items[1]", order, "pen"},
+		{"\"book\" in Items && !Paid", order, true},
+		{"Customer.First + \" \" + Customer.Last", order, "Bob Smith"},
+		{"Customer.FullName()", &order, "Bob Smith"},
+		{"Customer.IsAdult()", order, true},
+		{"Profile.Address.City", order, "Paris"},
+		{"Profile?.Address?.City ?? \"nowhere\"", testOrder{}, "nowhere"},
+		{"Discount ?? 0", order, int64(0)},
+		{"note ?? \"hidden\"", order, "hidden"},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExpr(test.input)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		for i := 0; i < 2; i++ {
+			res, err := expr.EvalStruct(test.params)
+			if err != nil {
+				t.Errorf("input %s failed to eval: %s", test.input, err)
+			} else if res != test.wanted {
+				t.Errorf("input %s: result '%v' does not match wanted: '%v'", test.input, res, test.wanted)
+			}
+		}
+	}
+}
+
+func TestEvalStructErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		params interface{}
+		wanted error
+	}{
+		{"Discount > 1", testOrder{}, ErrUnknownParameter},
+		{"Customer.Nickname", testOrder{Customer: &testUser{}}, ErrUnknownParameter},
+		{"Items[2]", testOrder{}, ErrIndexOutOfRange},
+		{"Customer.First", testOrder{}, ErrTypeMismatch},
+		{"Total > 1", map[string]interface{}{"Total": 1}, ErrTypeMismatch},
+		{"Total > 1", (*testOrder)(nil), ErrTypeMismatch},
+		{"Total > 1", nil, ErrTypeMismatch},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExpr(test.input)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		_, err = expr.EvalStruct(test.params)
+		if !errors.Is(err, test.wanted) {
+			t.Errorf("input %s: error %v should be %v", test.input, err, test.wanted)
+		}
+	}
+
+	// a nil pointer along the path is reported as such, with the path of the selector
+	expr, err := NewExpr("Customer.First")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = expr.EvalStruct(testOrder{})
+	var exprErr *Error
+	if !errors.As(err, &exprErr) || !strings.Contains(exprErr.Msg, "nil value for selector First") {
+		t.Fatalf("error %v should report a nil value", err)
+	}
+	if !reflect.DeepEqual(exprErr.Path, []string{"Customer", "First"}) {
+		t.Errorf("error path %v does not match wanted: [Customer First]", exprErr.Path)
+	}
+}
+
+// the path of a selector must not grow with the evaluations
+func TestSelectorRepeatedEval(t *testing.T) {
+	expr, err := NewExpr("a.b[0] + a.b[1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]interface{}{
+		"a": map[string]interface{}{"b": []interface{}{1, 2}},
+	}
+	for i := 0; i < 3; i++ {
+		res, err := expr.Eval(params)
+		if err != nil || res != int64(3) {
+			t.Fatalf("evaluation %d: result '%v', error %v", i, res, err)
+		}
+	}
+}
+
+type testPayload struct {
+	testBase
+	UserID  int          `json:"user_id" expr:"uid"`
+	Address *testAddress `json:"address,omitempty"`
+	Token   string       `json:"-"`
+}
+
+func TestEvalFieldNaming(t *testing.T) {
+	payload := &testPayload{
+		testBase: testBase{ID: 3, Name: "payload"},
+		UserID:   42,
+		Address:  &testAddress{City: "Paris"},
+		Token:    "secret",
+	}
+	tests := []struct {
+		input  string
+		opts   []Option
+		wanted interface{}
+	}{
+		{"UserID + ID", nil, int64(45)},
+		{"user_id", []Option{WithFieldTag("json")}, int64(42)},
+		{"ID + user_id", []Option{WithFieldTag("json")}, int64(45)},
+		{"uid", []Option{WithFieldTag("expr")}, int64(42)},
+		{"userid", []Option{WithCaseInsensitiveFields()}, int64(42)},
+		{"USER_ID", []Option{WithFieldTag("json"), WithCaseInsensitiveFields()}, int64(42)},
+		{"address.City", []Option{WithFieldTag("json")}, "Paris"},
+		{"address.city", []Option{WithFieldTag("json"), WithCaseInsensitiveFields()}, "Paris"},
+		{"name", []Option{WithCaseInsensitiveFields()}, "payload"},
+		{"(Token ?? user_id) == 42", []Option{WithFieldTag("json")}, true},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExpr(test.input, test.opts...)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		res, err := expr.EvalStruct(payload)
+		if err != nil {
+			t.Errorf("input %s failed to eval: %s", test.input, err)
+		} else if res != test.wanted {
+			t.Errorf("input %s: result '%v' does not match wanted: '%v'", test.input, res, test.wanted)
+		}
+	}
+
+	// structs within the parameters of Eval follow the same naming
+	params := map[string]interface{}{"p": payload}
+	evalTests := []struct {
+		input  string
+		opts   []Option
+		wanted interface{}
+	}{
+		{"p.user_id", []Option{WithFieldTag("json")}, int64(42)},
+		{"p.address?.City", []Option{WithFieldTag("json")}, "Paris"},
+		{"p.Address.city", []Option{WithCaseInsensitiveFields()}, "Paris"},
+		{"p.name", []Option{WithCaseInsensitiveFields()}, "payload"},
+	}
+	for _, test := range evalTests {
+		expr, err := NewExpr(test.input, test.opts...)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		res, err := expr.Eval(params)
+		if err != nil {
+			t.Errorf("input %s failed to eval: %s", test.input, err)
+		} else if res != test.wanted {
+			t.Errorf("input %s: result '%v' does not match wanted: '%v'", test.input, res, test.wanted)
+		}
+	}
+}
+
+var errTestRow = errors.New("row not loaded")
+
+// testRows resolves parameters as a database would, loading each row once
+type testRows struct {
+	rows   map[string]map[string]interface{}
+	loaded []string
+}
+
+func (r *testRows) Get(path []string) (interface{}, error) {
+	r.loaded = append(r.loaded, strings.Join(path, "."))
+	row, ok := r.rows[path[0]]
+	if !ok {
+		return nil, fmt.Errorf("no row %s: %w", path[0], ErrUnknownParameter)
+	}
+	if len(path) == 1 {
+		return row, nil
+	}
+	if path[1] == "broken" {
+		return nil, errTestRow
+	}
+	value, ok := row[path[1]]
+	if !ok {
+		return nil, fmt.Errorf("no column %s: %w", path[1], ErrUnknownParameter)
+	}
+	return value, nil
+}
+
+func TestEvalWith(t *testing.T) {
+	tests := []struct {
+		input  string
+		wanted interface{}
+		loaded []string
+	}{
+		{"user.age >= 18", true, []string{"user.age"}},
+		{"user.age < 18 && account.balance > 0", false, []string{"user.age"}},
+		{"user.name + \" \" + account.currency", "Bob EUR", []string{"user.name", "account.currency"}},
+		{"user.nickname ?? user.name", "Bob", []string{"user.nickname", "user.name"}},
+		{"visitor?.name ?? \"guest\"", "guest", []string{"visitor"}},
+		{"account.balance * 2", int64(200), []string{"account.balance"}},
+	}
+
+	for _, test := range tests {
+		rows := &testRows{rows: map[string]map[string]interface{}{
+			"user":    {"name": "Bob", "age": 20},
+			"account": {"balance": 100, "currency": "EUR"},
+		}}
+		expr, err := NewExpr(test.input)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		res, err := expr.EvalWith(rows)
+		if err != nil {
+			t.Errorf("input %s failed to eval: %s", test.input, err)
+		} else if res != test.wanted {
+			t.Errorf("input %s: result '%v' does not match wanted: '%v'", test.input, res, test.wanted)
+		}
+		if !reflect.DeepEqual(rows.loaded, test.loaded) {
+			t.Errorf("input %s: loaded %v, wanted %v", test.input, rows.loaded, test.loaded)
+		}
+	}
+}
+
+func TestEvalWithErrors(t *testing.T) {
+	rows := &testRows{rows: map[string]map[string]interface{}{"user": {}}}
+	tests := []struct {
+		input  string
+		wanted error
+	}{
+		{"user.age > 1", ErrUnknownParameter},
+		{"missing", ErrUnknownParameter},
+		{"user.broken", errTestRow},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExpr(test.input)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		_, err = expr.EvalWith(rows)
+		if !errors.Is(err, test.wanted) {
+			t.Errorf("input %s: error %v should be %v", test.input, err, test.wanted)
+		}
+		var exprErr *Error
+		if !errors.As(err, &exprErr) || exprErr.Pos.Line == 0 || len(exprErr.Path) == 0 {
+			t.Errorf("input %s: error %v should be located", test.input, err)
+		}
+	}
+}
+
+func TestMapParameters(t *testing.T) {
+	params := MapParameters{
+		"user":  map[string]interface{}{"tags": []interface{}{"a", "b"}},
+		"count": 3,
+	}
+	expr, err := NewExpr("user.tags[1] + \"c\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := expr.EvalWith(params); err != nil || res != "bc" {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+	if res, err := params.Get([]string{"count"}); err != nil || res != int64(3) {
+		t.Errorf("count is '%v', error %v", res, err)
+	}
+	if _, err := params.Get([]string{"user", "name"}); !errors.Is(err, ErrUnknownParameter) {
+		t.Errorf("error %v should be %v", err, ErrUnknownParameter)
+	}
+	if res, err := expr.EvalWith(nil); !errors.Is(err, ErrUnknownParameter) {
+		t.Errorf("result '%v', error %v should be %v", res, err, ErrUnknownParameter)
+	}
+}
+
+type testContextKey struct{}
+
+// testTenantRows resolves the parameters of the tenant found in the context
+type testTenantRows struct {
+	tenants map[string]map[string]interface{}
+}
+
+func (r testTenantRows) Get(path []string) (interface{}, error) {
+	return nil, fmt.Errorf("no tenant: %w", ErrUnknownParameter)
+}
+
+func (r testTenantRows) GetContext(ctx context.Context, path []string) (interface{}, error) {
+	tenant, _ := ctx.Value(testContextKey{}).(string)
+	value, ok := r.tenants[tenant][path[0]]
+	if !ok {
+		return nil, fmt.Errorf("no %s for tenant %s: %w", path[0], tenant, ErrUnknownParameter)
+	}
+	return value, nil
+}
+
+func TestEvalContext(t *testing.T) {
+	var calls int
+	functions := map[string]ExprContextFunc{
+		// wait blocks until the context is done
+		"wait": func(ctx context.Context, args ...interface{}) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		// step cancels the context given as its argument
+		"step": func(ctx context.Context, args ...interface{}) (interface{}, error) {
+			calls++
+			ctx.Value(testContextKey{}).(context.CancelFunc)()
+			return calls, nil
+		},
+		"tenant": func(ctx context.Context, args ...interface{}) (interface{}, error) {
+			return ctx.Value(testContextKey{}), nil
+		},
+	}
+
+	expr, err := NewExpr("wait() == nil", WithContextFunctions(functions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = expr.EvalContext(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v should be %v", err, context.DeadlineExceeded)
+	}
+
+	// the evaluation stops before the second call
+	expr, err = NewExpr("step() + step()", WithContextFunctions(functions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	ctx = context.WithValue(ctx, testContextKey{}, cancel)
+	_, err = expr.EvalContext(ctx, nil)
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("error %v should be %v after 1 call, got %d calls", err, context.Canceled, calls)
+	}
+	var exprErr *Error
+	if !errors.As(err, &exprErr) || exprErr.Pos.Column != 10 {
+		t.Errorf("error %v should be located at the second call", err)
+	}
+
+	// the context functions take precedence, and are given context.Background() by Eval
+	expr, err = NewExprWithFunctions("tenant() ?? \"none\"", testFunctions, WithContextFunctions(functions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := expr.Eval(nil); err != nil || res != "none" {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+
+	ctx = context.WithValue(context.Background(), testContextKey{}, "acme")
+	if res, err := expr.EvalContext(ctx, nil); err != nil || res != "acme" {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+}
+
+func TestEvalContextParameters(t *testing.T) {
+	rows := testTenantRows{tenants: map[string]map[string]interface{}{
+		"acme": {"plan": "pro"},
+	}}
+	expr, err := NewExpr("(plan ?? \"free\") == \"pro\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), testContextKey{}, "acme")
+	if res, err := expr.EvalContext(ctx, rows); err != nil || res != true {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+	if res, err := expr.EvalWith(rows); err != nil || res != false {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := expr.EvalContext(canceled, rows); !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v should be %v", err, context.Canceled)
+	}
+}
@@ -10,51 +10,85 @@ type astNode struct {
 	bothCheck  bothTypeCheck
 	calculator calculator
 	err        string
+	pos        Position // span of the node within the input
+	end        Position
+	constant   bool        // the value of the node is known at parse time
+	value      interface{} // value of constant nodes
+	path       []string    // name of VARIABLE and SELECTOR nodes, such as [a b] of a.b[0], or parts of ACCESSOR nodes
+	name       string      // name of the function or method of FUNC nodes
+	typ        *Type       // type of the value, inferred when the expression has a schema
+}
+
+// isParam reports whether the value of node is the parameter at its path, without index
+func (node *astNode) isParam() bool {
+	return (node.operator == VARIABLE || node.operator == SELECTOR) && node.rightList == nil
+}
+
+// isNilSafeOperand reports whether an unknown parameter within node is taken as nil on the left of ?? and ?.,
+// which is the case for a parameter or a selector, not for an operation on them such as missing + 1,
+// so that a misspelled parameter is still reported. an optional chain needs no guard as it yields nil itself
+func (node *astNode) isNilSafeOperand() bool {
+	switch node.operator {
+	case VARIABLE, SELECTOR:
+		return true
+	case CLAUSE:
+		return node.right.isNilSafeOperand()
+	}
+	return false
 }
 
 type nodeTypeCheck func(value interface{}) bool
 type bothTypeCheck func(left, right interface{}) bool
-type calculator func(left, right interface{}, params map[string]interface{}) (interface{}, error)
+type calculator func(left, right interface{}, ctx evalContext) (interface{}, error)
 
 var opCalculator = map[TokenType]calculator{
-	EQ:           calculatorEQ,
-	NEQ:          calculatorNEQ,
-	GT:           calculatorGT,
-	GEQ:          calculatorGEQ,
-	LT:           calculatorLT,
-	LEQ:          calculatorLEQ,
-	ADD:          calculatorADD,
-	SUB:          calculatorSUB,
-	MUL:          calculatorMUL,
-	QUO:          calculatorQUO,
-	REM:          calculatorREM,
-	AND:          calculatorAND,
-	OR:           calculatorOR,
-	XOR:          calculatorXOR,
-	SHL:          calculatorSHL,
-	SHR:          calculatorSHR,
-	LAND:         calculatorLAND,
-	LOR:          calculatorLOR,
-	TERNARY_IF:   calculatorTernaryIf,
-	TERNARY_ELSE: calculatorTernaryElse,
-	NOT:          calculatorNOT,
-	NEG:          calculatorNEG,
+	EQ:        calculatorEQ,
+	NEQ:       calculatorNEQ,
+	GT:        calculatorGT,
+	GEQ:       calculatorGEQ,
+	LT:        calculatorLT,
+	LEQ:       calculatorLEQ,
+	ADD:       calculatorADD,
+	SUB:       calculatorSUB,
+	MUL:       calculatorMUL,
+	QUO:       calculatorQUO,
+	REM:       calculatorREM,
+	AND:       calculatorAND,
+	OR:        calculatorOR,
+	XOR:       calculatorXOR,
+	SHL:       calculatorSHL,
+	SHR:       calculatorSHR,
+	LAND:      calculatorLAND,
+	LOR:       calculatorLOR,
+	MATCH:     calculatorMATCH(nil),
+	NOT_MATCH: calculatorNOTMATCH(nil),
+	COALESCE:  calculatorCOALESCE,
+	IN:        calculatorIN,
+	NOT_IN:    calculatorNOTIN,
+	NOT:       calculatorNOT,
+	NEG:       calculatorNEG,
 }
 
 func buildSelectorNode(token LexerToken) *astNode {
 	return &astNode{
-		operator:   LITERAL,
+		operator:   SELECTOR,
+		path:       token.Value.([]string),
 		right:      nil,
 		calculator: calculatorSELECTOR(token.Value.([]string)),
 		err:        errSelectorFormat,
+		pos:        token.Pos,
+		end:        token.End,
 	}
 }
 
 func buildAccessorNode(token LexerToken) *astNode {
 	return &astNode{
-		operator:   LITERAL,
+		operator:   ACCESSOR,
+		path:       token.Value.([]string),
 		right:      nil,
 		calculator: calculatorACCESSOR(token.Value.([]string)),
 		err:        errAccessorFormat,
+		pos:        token.Pos,
+		end:        token.End,
 	}
 }
@@ -2,254 +2,338 @@ package goexpr
 
 import "fmt"
 
-func parseAST(tokens []LexerToken) (*astNode, error) {
+// parseAST parses the tokens, the depth of the AST is bounded by the MaxDepth of limits, if any.
+// any function is accepted when functions is nil, which is only meant for trees never evaluated, such as by Format
+func parseAST(tokens []LexerToken, functions map[string]ExprContextFunc, limits *Limits) (*astNode, error) {
 	stream := newLexerStream(tokens)
+	stream.functions = functions
+	if limits != nil {
+		stream.maxDepth = limits.MaxDepth
+	}
+
+	if !stream.notEOF() {
+		return nil, nil
+	}
 
-	ast, err := parseAst(stream)
+	ast, err := parseExpr(stream, priorityTENARY)
 	if err != nil {
 		return nil, err
 	}
-
-	adjustAst(ast)
-
+	if stream.notEOF() {
+		token := stream.flowForward()
+		return nil, newSyntaxError(token.Pos, token.End, "unexpected token %v", token.Value)
+	}
 	return ast, nil
 }
 
-func parseAst(stream *lexerStream) (*astNode, error) {
-	if !stream.notEOF() {
-		return nil, nil
+// parseExpr parses operands joined by binary operators with a priority not lower than minPriority.
+// the right operand is parsed with a higher priority, so that operators with the same priority
+// are folded to the left as soon as they are read: 1 - 2 - 3 is parsed into (1 - 2) - 3
+// different operators have different priorities
+// ref: https://en.cppreference.com/w/c/language/operator_precedence
+func parseExpr(stream *lexerStream, minPriority opPriority) (*astNode, error) {
+	if err := stream.enter(); err != nil {
+		return nil, err
 	}
-	priority := stream.getLowestPriority()
-	switch priority {
-	case priorityLITERAL, priorityPREFIX, priorityCLAUSE:
-		return parseSelectorAndVariable(stream)
-	case priorityMUL:
-		return parseMul(stream)
-	case priorityADD:
-		return parseAdd(stream)
-	case priorityBITSHIFT:
-		return parseBitShift(stream)
-	case priorityCOMPARER:
-		return parseComparer(stream)
-	case priorityBIT:
-		return parseBit(stream)
-	case priorityLAND:
-		return parseLogicalAnd(stream)
-	case priorityLOR:
-		return parseLogicalOr(stream)
-	default:
-		return parseTernary(stream)
+	defer stream.leave()
+
+	left, err := parsePrefix(stream)
+	if err != nil {
+		return nil, err
 	}
-}
 
-type parser func(stream *lexerStream) (*astNode, error)
-
-var (
-	parsePrefix     parser
-	parseMul        parser
-	parseAdd        parser
-	parseBit        parser
-	parseBitShift   parser
-	parseComparer   parser
-	parseLogicalAnd parser
-	parseLogicalOr  parser
-	parseTernary    parser
-)
-
-type parserPkg struct {
-	validToken   map[TokenType]struct{}
-	nextPriority parser // higher priority
-	rightParser  parser // right part
-	errFormat    string
-}
+	for stream.notEOF() {
+		token := stream.peek()
+		priority := token.Type.Priority()
+		if !token.Type.isBinary() || priority < minPriority {
+			break
+		}
+		stream.flowForward()
 
-func init() {
-	// different operators have different priorities
-	// ref: https://en.cppreference.com/w/c/language/operator_precedence
-	parsePrefix = buildParserWithPkg(&parserPkg{
-		validToken:  tokenPREFIX,
-		rightParser: parseSelectorAndVariable,
-		errFormat:   errPrefixFormat,
-	})
-	parseMul = buildParserWithPkg(&parserPkg{
-		validToken:   tokenMUL,
-		nextPriority: parseSelectorAndVariable,
-		errFormat:    errNumericFormat,
-	})
-	parseAdd = buildParserWithPkg(&parserPkg{
-		validToken:   tokenADD,
-		nextPriority: parseMul,
-		errFormat:    errNumericFormat,
-	})
-	parseBitShift = buildParserWithPkg(&parserPkg{
-		validToken:   tokenBITSHIFT,
-		nextPriority: parseAdd,
-		errFormat:    errNumericFormat,
-	})
-	parseComparer = buildParserWithPkg(&parserPkg{
-		validToken:   tokenCOMPARER,
-		nextPriority: parseBitShift,
-		errFormat:    errComparerFormat,
-	})
-	parseBit = buildParserWithPkg(&parserPkg{
-		validToken:   tokenBIT,
-		nextPriority: parseComparer,
-		errFormat:    errNumericFormat,
-	})
-	parseLogicalAnd = buildParserWithPkg(&parserPkg{
-		validToken:   map[TokenType]struct{}{LAND: {}},
-		nextPriority: parseBit,
-		errFormat:    errLogicalFormat,
-	})
-	parseLogicalOr = buildParserWithPkg(&parserPkg{
-		validToken:   map[TokenType]struct{}{LOR: {}},
-		nextPriority: parseLogicalAnd,
-		errFormat:    errLogicalFormat,
-	})
-	parseTernary = buildParserWithPkg(&parserPkg{
-		validToken:   tokenTERNARY,
-		nextPriority: parseLogicalOr,
-		errFormat:    errTernaryFormat,
-	})
-}
+		if token.Type == TERNARY_IF {
+			left, err = parseTernary(stream, token, left)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
 
-func buildParserWithPkg(pkg *parserPkg) parser {
-	var (
-		parsed    parser
-		nextRight parser
-	)
-	parsed = func(stream *lexerStream) (*astNode, error) {
-		return parseAstNode(stream, pkg.validToken, pkg.nextPriority, nextRight, pkg.errFormat)
+		right, err := parseExpr(stream, priority+1)
+		if err != nil {
+			return nil, err
+		}
+		left = buildOperatorNode(token, left, right)
+		if _, ok := tokenMATCH[token.Type]; ok {
+			if err = compileConstantPattern(left); err != nil {
+				return nil, err
+			}
+		}
 	}
+	return left, nil
+}
 
-	if pkg.rightParser != nil {
-		nextRight = pkg.rightParser
-	} else {
-		nextRight = parsed
+// cond ? then : else, the else part is optional,
+// the ternary operator is right associative: a ? b : c ? d : e is parsed into a ? b : (c ? d : e)
+func parseTernary(stream *lexerStream, token LexerToken, cond *astNode) (*astNode, error) {
+	branch, err := parseExpr(stream, priorityTENARY)
+	if err != nil {
+		return nil, err
 	}
-	return parsed
-}
 
-func parseAstNode(stream *lexerStream, validToken map[TokenType]struct{}, leftParser, rightParser parser, errFormat string) (*astNode, error) {
-	var (
-		token LexerToken
-		op    TokenType
-		left  *astNode
-		right *astNode
-		check typeChecks
-		err   error
-	)
-	if leftParser != nil {
-		left, err = leftParser(stream)
+	if stream.nextIs(TERNARY_ELSE) {
+		elseToken := stream.flowForward()
+		otherwise, err := parseExpr(stream, priorityTENARY)
 		if err != nil {
 			return nil, err
 		}
+		branch = buildOperatorNode(elseToken, branch, otherwise)
 	}
-	for stream.notEOF() {
-		token = stream.flowForward()
-
-		// check if it is a valid operator
-		if validToken != nil {
-			if _, ok := validToken[token.Type]; !ok {
-				break
-			} else {
-				op = token.Type
-			}
-		}
+	return buildOperatorNode(token, cond, branch), nil
+}
 
-		if rightParser != nil {
-			right, err = rightParser(stream)
-			if err != nil {
-				return nil, err
-			}
-		}
+func parsePrefix(stream *lexerStream) (*astNode, error) {
+	if !stream.notEOF() {
+		return nil, stream.eofError("unexpected end of expression")
+	}
+
+	token := stream.peek()
+	if _, ok := tokenPREFIX[token.Type]; !ok {
+		return parseSelectorAndVariable(stream)
+	}
+	stream.flowForward()
+	if err := stream.enter(); err != nil {
+		return nil, err
+	}
+	defer stream.leave()
 
-		check = getTypeChecks(op)
+	right, err := parsePrefix(stream)
+	if err != nil {
+		return nil, err
+	}
+	return buildOperatorNode(token, nil, right), nil
+}
 
-		return &astNode{
-			operator:   op,
-			left:       left,
-			right:      right,
-			leftCheck:  check.left,
-			rightCheck: check.right,
-			bothCheck:  check.both,
-			calculator: opCalculator[op],
-			err:        errFormat,
-		}, nil
+// buildOperatorNode builds the node of the operator token, spanning from its left operand,
+// or the operator itself for prefix operators, to its right operand
+func buildOperatorNode(token LexerToken, left, right *astNode) *astNode {
+	op := token.Type
+	check := getTypeChecks(op)
+	node := &astNode{
+		operator:   op,
+		left:       left,
+		right:      right,
+		leftCheck:  check.left,
+		rightCheck: check.right,
+		bothCheck:  check.both,
+		calculator: opCalculator[op],
+		err:        getErrFormat(op),
+		pos:        token.Pos,
+		end:        right.end,
 	}
-	stream.flowBackward()
-	return left, nil
+	if left != nil {
+		node.pos = left.pos
+	}
+	return node
 }
 
 func parseSelectorAndVariable(stream *lexerStream) (*astNode, error) {
 	var (
-		rightNode *astNode
-		nextToken LexerToken
-		err       error
+		node      *astNode
 		rightList []*astNode
 		cal       calculator
+		err       error
 	)
 
-	if !stream.notEOF() {
-		return nil, nil
-	}
 	token := stream.flowForward()
 	if token.Type != VARIABLE && token.Type != SELECTOR && token.Type != ACCESSOR {
 		stream.flowBackward()
 		return parseValue(stream)
 	}
+	if token.Type == ACCESSOR {
+		return nil, newSyntaxError(token.Pos, token.End, "accessor %v without parameter", token.Value)
+	}
 
-	if (token.Type == SELECTOR || token.Type == ACCESSOR) && stream.notEOF() {
-		if stream.flowForward().Type == LPAREN {
-			rightNode, err = parseAst(stream)
-			if err != nil {
-				return nil, err
-			}
-			return &astNode{
-				operator:   LITERAL,
-				right:      rightNode,
-				calculator: calculatorVARIABLE(token.Value.(string)),
-				err:        errSelectorFormat,
-			}, nil
-		} else {
-			stream.flowBackward()
+	if token.Type == SELECTOR && stream.nextIs(LPAREN) {
+		// a.b.Method(...), the receiver is a.b
+		parts := token.Value.([]string)
+		receiver := &astNode{
+			operator:   SELECTOR,
+			calculator: calculatorSELECTOR(parts[:len(parts)-1]),
+			err:        errSelectorFormat,
+			pos:        token.Pos,
+			end:        token.End,
+			path:       parts[:len(parts)-1],
+		}
+		if len(parts) == 2 {
+			receiver.operator = VARIABLE
+			receiver.calculator = calculatorVARIABLE(parts[0])
 		}
+		node, err = parseMethod(stream, receiver, parts[len(parts)-1])
+		if err != nil {
+			return nil, err
+		}
+		return parseMethodChain(stream, node)
+	}
+
+	rightList, err = parsePathSegments(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	var path []string
+	if token.Type == SELECTOR {
+		path = token.Value.([]string)
+		cal = calculatorSELECTOR(path)
+	} else {
+		path = []string{token.Value.(string)}
+		cal = calculatorVARIABLE(path[0])
 	}
 
-	rightList = make([]*astNode, 0)
+	node = &astNode{
+		operator:   token.Type,
+		calculator: cal,
+		err:        errSelectorFormat,
+		rightList:  rightList,
+		pos:        token.Pos,
+		end:        stream.prevEnd(),
+		path:       path,
+	}
+	return parseMethodChain(stream, node)
+}
+
+// parsePathSegments collects [index], .selector and .accessor segments following a parameter,
+// it stops before an accessor which is a method call
+func parsePathSegments(stream *lexerStream) ([]*astNode, error) {
+	var rightList []*astNode
 	for stream.notEOF() {
-		nextToken = stream.flowForward()
+		nextToken := stream.flowForward()
 		if nextToken.Type == LBRACKET {
-			stream.flowBackward()
-			rightNode, err = parseAst(stream)
+			index, err := parseExpr(stream, priorityTENARY)
 			if err != nil {
 				return nil, err
 			}
-			rightList = append(rightList, rightNode)
+			if !stream.nextIs(RBRACKET) {
+				return nil, newSyntaxError(nextToken.Pos, nextToken.End, "unbalanced parenthesis or bracket")
+			}
+			stream.flowForward()
+			rightList = append(rightList, index)
 		} else if nextToken.Type == SELECTOR {
 			rightList = append(rightList, buildSelectorNode(nextToken))
-		} else if nextToken.Type == ACCESSOR {
+		} else if nextToken.Type == ACCESSOR && !stream.nextIs(LPAREN) {
 			rightList = append(rightList, buildAccessorNode(nextToken))
 		} else {
 			stream.flowBackward()
 			break
 		}
 	}
+	return rightList, nil
+}
+
+// parseMethodChain parses method calls and path segments applied on the value of node,
+// e.g. the .Method() and [0].Name parts of user.Orders()[0].Name
+func parseMethodChain(stream *lexerStream, node *astNode) (*astNode, error) {
+	for stream.notEOF() {
+		token := stream.flowForward()
+		if token.Type == OPTIONAL {
+			optional, err := parseOptional(stream, token, node)
+			if err != nil {
+				return nil, err
+			}
+			node = optional
+			continue
+		}
+		if token.Type == ACCESSOR && stream.nextIs(LPAREN) {
+			parts := token.Value.([]string)
+			if len(parts) > 1 {
+				accessor := LexerToken{Type: ACCESSOR, Value: parts[:len(parts)-1], Pos: token.Pos, End: token.End}
+				node = &astNode{
+					operator:   LITERAL,
+					left:       node,
+					rightList:  []*astNode{buildAccessorNode(accessor)},
+					calculator: calculatorINDEX,
+					err:        errAccessorFormat,
+					pos:        node.pos,
+					end:        token.End,
+				}
+			}
+			method, err := parseMethod(stream, node, parts[len(parts)-1])
+			if err != nil {
+				return nil, err
+			}
+			node = method
+			continue
+		}
+		stream.flowBackward()
 
-	rightNode, rightList = resetRightAndRightList(rightNode, rightList)
+		if node.operator != FUNC {
+			break
+		}
+		rightList, err := parsePathSegments(stream)
+		if err != nil {
+			return nil, err
+		}
+		if len(rightList) == 0 {
+			break
+		}
+		node = &astNode{
+			operator:   LITERAL,
+			left:       node,
+			rightList:  rightList,
+			calculator: calculatorINDEX,
+			err:        errAccessorFormat,
+			pos:        node.pos,
+			end:        stream.prevEnd(),
+		}
+	}
+	return node, nil
+}
 
-	if token.Type == SELECTOR {
-		cal = calculatorSELECTOR(token.Value.([]string))
-	} else if token.Type == VARIABLE {
-		cal = calculatorVARIABLE(token.Value.(string))
+// parseOptional parses the path following ?. which is applied on the value of node,
+// the node evaluates to nil instead of failing when the value is nil or misses a field along the path
+func parseOptional(stream *lexerStream, token LexerToken, node *astNode) (*astNode, error) {
+	if !stream.notEOF() {
+		return nil, stream.eofError("missing field after %v", token.Value)
+	}
+	name := stream.flowForward()
+	var parts []string
+	switch name.Type {
+	case VARIABLE:
+		parts = []string{name.Value.(string)}
+	case SELECTOR:
+		parts = name.Value.([]string)
+	default:
+		return nil, newSyntaxError(name.Pos, name.End, "unexpected token %v after %v", name.Value, token.Value)
 	}
 
+	accessor := LexerToken{Type: ACCESSOR, Value: parts, Pos: name.Pos, End: name.End}
+	rightList, err := parsePathSegments(stream)
+	if err != nil {
+		return nil, err
+	}
 	return &astNode{
-		operator:   LITERAL,
-		right:      rightNode,
-		calculator: cal,
-		err:        errSelectorFormat,
-		rightList:  rightList,
+		operator:   OPTIONAL,
+		left:       node,
+		rightList:  append([]*astNode{buildAccessorNode(accessor)}, rightList...),
+		calculator: calculatorOPTIONAL,
+		err:        errAccessorFormat,
+		pos:        node.pos,
+		end:        stream.prevEnd(),
+	}, nil
+}
+
+func parseMethod(stream *lexerStream, receiver *astNode, name string) (*astNode, error) {
+	args, err := parseArguments(stream, name)
+	if err != nil {
+		return nil, err
+	}
+	return &astNode{
+		operator:   FUNC,
+		left:       receiver,
+		rightList:  args,
+		calculator: calculatorMETHOD(name),
+		name:       name,
+		pos:        receiver.pos,
+		end:        stream.prevEnd(),
 	}, nil
 }
 
@@ -258,135 +342,116 @@ func parseValue(stream *lexerStream) (*astNode, error) {
 		cal calculator
 		op  TokenType
 	)
-	if !stream.notEOF() {
-		return nil, nil
-	}
 
 	token := stream.flowForward()
 
 	switch token.Type {
-	case LPAREN, LBRACKET:
-		node, err := parseAst(stream)
+	case LPAREN:
+		node, err := parseExpr(stream, priorityTENARY)
 		if err != nil {
 			return nil, err
 		}
-
+		if !stream.nextIs(RPAREN) {
+			return nil, newSyntaxError(token.Pos, token.End, "unbalanced parenthesis or bracket")
+		}
 		stream.flowForward() // jump over the RPAREN
+
 		node = &astNode{
 			operator:   CLAUSE,
 			right:      node,
 			calculator: calculatorCLAUSE,
+			pos:        token.Pos,
+			end:        stream.prevEnd(),
 		}
 		return node, nil
-	case NEG, NOT:
-		stream.flowBackward()
-		return parsePrefix(stream)
-	case NUMBER, STRING, CHAR, BOOL:
+	case FUNC:
+		return parseFunction(stream, token)
+	case LBRACKET:
+		return parseArray(stream, token)
+	case NUMBER, STRING, CHAR, BOOL, NIL:
 		op = LITERAL
 		cal = calculatorLITERAL(token.Value)
 	}
 	if cal == nil {
-		return nil, fmt.Errorf("unable to deal with token type: %s, value: %v", token.Type.String(), token.Value)
+		return nil, newSyntaxError(token.Pos, token.End, "unable to deal with token type: %s, value: %v", token.Type.String(), token.Value)
 	}
 	return &astNode{
 		operator:   op,
 		calculator: cal,
+		pos:        token.Pos,
+		end:        token.End,
+		constant:   true,
+		value:      token.Value,
 	}, nil
 }
 
-func resetRightAndRightList(right *astNode, rightList []*astNode) (*astNode, []*astNode) {
-	if rightList == nil {
-		return right, rightList
+// name(arg1, arg2, ...), arguments are always kept in rightList
+// so that the calculator receives them as a list whatever their count
+func parseFunction(stream *lexerStream, token LexerToken) (*astNode, error) {
+	name := token.Value.(string)
+	function, ok := stream.functions[name]
+	if !ok && stream.functions != nil {
+		return nil, newSyntaxError(token.Pos, token.End, "undefined function '%s'", name)
 	}
-	switch {
-	case len(rightList) > 1:
-		right = nil
-	case len(rightList) == 1:
-		right = rightList[0]
-		rightList = nil
-	case len(rightList) == 0:
-		rightList = nil
+	args, err := parseArguments(stream, name)
+	if err != nil {
+		return nil, err
 	}
-	return right, rightList
+	return &astNode{
+		operator:   FUNC,
+		rightList:  args,
+		calculator: calculatorFUNC(name, function),
+		name:       name,
+		pos:        token.Pos,
+		end:        stream.prevEnd(),
+	}, nil
 }
 
-// need to adjust operator seq, because nodes with equal priority are parsed into a reverse order to evaluate
-// this will get the wrong result if using the original AST
-func adjustAst(root *astNode) {
-	var (
-		samePriority []*astNode
-		tmp          *astNode
-		priority     opPriority
-	)
-	tmp = root
-	priority = root.operator.Priority() //root priority
-
-	for tmp != nil {
-		if tmp.left != nil {
-			adjustAst(tmp.left)
-		}
-
-		if tmp.operator.Priority() != priority {
-			// if tmp has different priorities, swap the same priority nodes
-			if len(samePriority) > 1 {
-				swapTrees(samePriority)
-			}
-			// reset priority and same priority list
-			samePriority = []*astNode{tmp}
-			priority = tmp.operator.Priority()
-			tmp = tmp.right
-			continue
-		}
-		// if tmp has the same priority, add into list and keep searching
-		samePriority = append(samePriority, tmp)
-		tmp = tmp.right
-	}
-	// if same priority nodes are still more than 1, deal with it
-	if len(samePriority) > 1 {
-		swapTrees(samePriority)
+// parseArguments parses (arg1, arg2, ...) of the function or method name
+func parseArguments(stream *lexerStream, name string) ([]*astNode, error) {
+	if !stream.nextIs(LPAREN) {
+		end := stream.prevEnd()
+		return nil, newSyntaxError(end, end, "missing parenthesis after function '%s'", name)
 	}
+	lparen := stream.flowForward()
+	return parseList(stream, lparen, RPAREN, fmt.Sprintf("arguments of function '%s'", name))
 }
-func swapTrees(nodes []*astNode) {
-	var tmp *astNode
-	length := len(nodes)
-	// reverse left and right of all the nodes
-	for _, node := range nodes {
-		tmp = node.right
-		node.right = node.left
-		node.left = tmp
-	}
 
-	// end left swap with root right
-	tmp = nodes[0].right
-	nodes[0].right = nodes[length-1].left
-	nodes[length-1].left = tmp
-
-	// swap right tree of counterparts in the list except the root
-	for i := 0; i < length/2; i++ {
-		tmp = nodes[i+1].right
-		nodes[i+1].right = nodes[length-i-1].right
-		nodes[length-i-1].right = tmp
-	}
-
-	// swap all other information of all counterpart nodes
-	for i := 0; i < length/2; i++ {
-		swap(nodes[i], nodes[length-i-1])
+// [elem1, elem2, ...], elements are evaluated into a []interface{}
+func parseArray(stream *lexerStream, token LexerToken) (*astNode, error) {
+	elems, err := parseList(stream, token, RBRACKET, "array literal")
+	if err != nil {
+		return nil, err
 	}
+	return &astNode{
+		operator:   ARRAY,
+		rightList:  elems,
+		calculator: calculatorARRAY,
+		pos:        token.Pos,
+		end:        stream.prevEnd(),
+	}, nil
 }
 
-func swap(x *astNode, y *astNode) {
-	tmp := *y
-	y.operator = x.operator
-	y.calculator = x.calculator
-	y.leftCheck = x.leftCheck
-	y.rightCheck = x.rightCheck
-	y.bothCheck = x.bothCheck
-	y.err = x.err
-
-	x.operator = tmp.operator
-	x.calculator = tmp.calculator
-	x.leftCheck = tmp.leftCheck
-	x.rightCheck = tmp.rightCheck
-	x.bothCheck = tmp.bothCheck
-	x.err = tmp.err
+// parseList parses comma-separated expressions following the opening token until the closing token type,
+// what describes the list in errors
+func parseList(stream *lexerStream, open LexerToken, closing TokenType, what string) ([]*astNode, error) {
+	list := make([]*astNode, 0)
+	for stream.notEOF() {
+		if stream.nextIs(closing) {
+			stream.flowForward()
+			return list, nil
+		}
+		if len(list) > 0 {
+			if next := stream.flowForward(); next.Type != COMMA {
+				return nil, newSyntaxError(next.Pos, next.End, "unexpected token %v in %s", next.Value, what)
+			}
+		}
+
+		elem, err := parseExpr(stream, priorityTENARY)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, elem)
+	}
+	return nil, newSyntaxError(open.Pos, open.End, "unclosed %s", what)
 }
@@ -0,0 +1,270 @@
+package goexpr
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type ParseStructureTest struct {
+	Name   string
+	Input  string
+	Wanted string
+}
+
+func TestParseAstStructure(t *testing.T) {
+	parseStructureTests := []ParseStructureTest{
+		{
+			Name:   "Left Associative SUB",
+			Input:  "1 - 2 - 3",
+			Wanted: "(- (- 1 2) 3)",
+		},
+		{
+			Name:   "Left Associative Mixed",
+			Input:  "1 + 2 - 3 + 4",
+			Wanted: "(+ (- (+ 1 2) 3) 4)",
+		},
+		{
+			Name:   "Left Associative QUO",
+			Input:  "8 / 4 / 2 * 3",
+			Wanted: "(* (/ (/ 8 4) 2) 3)",
+		},
+		{
+			Name:   "Priority",
+			Input:  "1 + 2 * 3 - 4",
+			Wanted: "(- (+ 1 (* 2 3)) 4)",
+		},
+		{
+			Name:   "Priority BITSHIFT",
+			Input:  "4 + 3 << 2 * 2",
+			Wanted: "(<< (+ 4 3) (* 2 2))",
+		},
+		{
+			Name:   "Priority LOGICAL",
+			Input:  "true || false && true",
+			Wanted: "(|| true (&& false true))",
+		},
+		{
+			Name:   "Priority MEMBERSHIP",
+			Input:  "1 + 1 in [2, 3 - 1] == true",
+			Wanted: "(== (in (+ 1 1) [2 (- 3 1)]) true)",
+		},
+		{
+			Name:   "Priority COALESCE",
+			Input:  "1 ?? 2 || 3 ? 4 : 5",
+			Wanted: "(? (?? 1 (|| 2 3)) (: 4 5))",
+		},
+		{
+			Name:   "Prefix",
+			Input:  "-1 * -2",
+			Wanted: "(* (- 1) (- 2))",
+		},
+		{
+			Name:   "Nested Prefix",
+			Input:  "!(!true)",
+			Wanted: "(! (CLAUSE (! true)))",
+		},
+		{
+			Name:   "Clause",
+			Input:  "1 - (2 - 3)",
+			Wanted: "(- 1 (CLAUSE (- 2 3)))",
+		},
+		{
+			Name:   "Subtraction After Clause",
+			Input:  "(1) - (2)",
+			Wanted: "(- (CLAUSE 1) (CLAUSE 2))",
+		},
+		{
+			Name:   "Subtraction After TERNARY",
+			Input:  "(1 != 2 ? 3 : 4) - (1 == 2 ? 3 : 4)",
+			Wanted: "(- (CLAUSE (? (!= 1 2) (: 3 4))) (CLAUSE (? (== 1 2) (: 3 4))))",
+		},
+		{
+			Name:   "Ternary",
+			Input:  "1 > 2 ? 3 : 4",
+			Wanted: "(? (> 1 2) (: 3 4))",
+		},
+		{
+			Name:   "Right Associative Ternary",
+			Input:  "true ? 1 : false ? 2 : 3",
+			Wanted: "(? true (: 1 (? false (: 2 3))))",
+		},
+		{
+			Name:   "Ternary Without Else",
+			Input:  "1 < 2 || false ? 3 + 4",
+			Wanted: "(? (|| (< 1 2) false) (+ 3 4))",
+		},
+	}
+
+	for _, test := range parseStructureTests {
+		tokens, err := lexerScan(test.Input)
+		if err != nil {
+			t.Errorf("Test '%s' with input %s failed to scan: %s", test.Name, test.Input, err)
+			continue
+		}
+		ast, err := parseAST(tokens, nil, nil)
+		if err != nil {
+			t.Errorf("Test '%s' with input %s failed to parse: %s", test.Name, test.Input, err)
+			continue
+		}
+		if res := formatTestAst(ast); res != test.Wanted {
+			t.Errorf("Test '%s' with input %s: ast %s does not match wanted: %s", test.Name, test.Input, res, test.Wanted)
+		}
+	}
+}
+
+// formatTestAst prints the ast in prefix notation, literals are evaluated
+func formatTestAst(node *astNode) string {
+	switch {
+	case node.operator == LITERAL:
+		value, _ := node.calculator(nil, nil, evalContext{})
+		return fmt.Sprint(value)
+	case node.operator == CLAUSE:
+		return "(CLAUSE " + formatTestAst(node.right) + ")"
+	case node.operator == ARRAY:
+		elems := make([]string, len(node.rightList))
+		for i, elem := range node.rightList {
+			elems[i] = formatTestAst(elem)
+		}
+		return "[" + strings.Join(elems, " ") + "]"
+	case node.left == nil:
+		return "(" + node.operator.String() + " " + formatTestAst(node.right) + ")"
+	}
+	return "(" + node.operator.String() + " " + formatTestAst(node.left) + " " + formatTestAst(node.right) + ")"
+}
+
+func TestParseAstRegression(t *testing.T) {
+	params := map[string]interface{}{
+		"a": []interface{}{10, 20, 30},
+		"m": map[string]interface{}{"k": 2},
+		"x": 7,
+	}
+	parseAstTests := []ParseAstTest{
+		{
+			Name:   "Bracket Followed By Operator",
+			Input:  "a[0] + 1",
+			Params: params,
+			Wanted: int64(11),
+		},
+		{
+			Name:   "Brackets In Operation",
+			Input:  "a[1] * 2 + a[2]",
+			Params: params,
+			Wanted: int64(70),
+		},
+		{
+			Name:   "Bracket With Operation",
+			Input:  "a[3 - 1 - 1] - a[0]",
+			Params: params,
+			Wanted: int64(10),
+		},
+		{
+			Name:   "Bracket With Selector Operation",
+			Input:  `a[m.k - 1] == a[m["k"] - 1]`,
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Short Circuit LAND",
+			Input:  "false && unknown",
+			Params: params,
+			Wanted: false,
+		},
+		{
+			Name:   "Short Circuit LOR",
+			Input:  "true || unknown",
+			Params: params,
+			Wanted: true,
+		},
+		{
+			Name:   "Short Circuit TERNARY",
+			Input:  "x > 5 ? x : unknown",
+			Params: params,
+			Wanted: int64(7),
+		},
+		{
+			Name:   "Ternary In Operation",
+			Input:  "1 + (x > 5 ? 1 : 2) * 10",
+			Params: params,
+			Wanted: int64(11),
+		},
+		{
+			Name:   "Ternary Nil Branch",
+			Input:  `true ? m.missing : "else"`,
+			Params: map[string]interface{}{"m": map[string]interface{}{"missing": nil}},
+			Wanted: nil,
+		},
+	}
+	runParseAstTests(parseAstTests, t)
+}
+
+func TestParseAstLongExpressions(t *testing.T) {
+	const terms = 500
+
+	var sub, ternary, logical, nested strings.Builder
+	sub.WriteString("1")
+	for i := 1; i < terms; i++ {
+		sub.WriteString(" - 1")
+	}
+	for i := 0; i < terms; i++ {
+		fmt.Fprintf(&ternary, "x == %d ? %d : ", i, i*2)
+	}
+	ternary.WriteString("-1")
+	for i := 0; i < terms; i++ {
+		logical.WriteString("false || ")
+	}
+	logical.WriteString("true")
+	nested.WriteString(strings.Repeat("(1 + ", terms))
+	nested.WriteString("0")
+	nested.WriteString(strings.Repeat(")", terms))
+
+	parseAstTests := []ParseAstTest{
+		{
+			Name:   "Long SUB",
+			Input:  sub.String(),
+			Wanted: int64(1 - (terms - 1)),
+		},
+		{
+			Name:   "Long TERNARY",
+			Input:  ternary.String(),
+			Params: map[string]interface{}{"x": terms - 1},
+			Wanted: int64((terms - 1) * 2),
+		},
+		{
+			Name:   "Long LOGICAL",
+			Input:  logical.String(),
+			Wanted: true,
+		},
+		{
+			Name:   "Nested PAREN",
+			Input:  nested.String(),
+			Wanted: int64(terms),
+		},
+	}
+	runParseAstTests(parseAstTests, t)
+}
+
+func TestParseAstErrors(t *testing.T) {
+	inputs := []string{
+		"1 +",
+		"1 2",
+		"(1 + 2",
+		"1 + 2)",
+		"a[1",
+		"()",
+		": 1",
+		"1 ? 2 : ",
+		"[1, 2",
+		"[1 2]",
+		"x in",
+		"not in [1]",
+		"a?.",
+		"a?.Method()",
+		"a ??",
+	}
+	for _, input := range inputs {
+		if _, err := NewExpr(input); err == nil {
+			t.Errorf("input %s should fail to parse", input)
+		}
+	}
+}
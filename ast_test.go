@@ -0,0 +1,187 @@
+package goexpr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// formatTestNode prints the public tree in prefix notation
+func formatTestNode(node Node) string {
+	switch n := node.(type) {
+	case nil:
+		return "<nil>"
+	case *Literal:
+		if s, ok := n.Value.(string); ok {
+			return fmt.Sprintf("%q", s)
+		}
+		return fmt.Sprint(n.Value)
+	case *Variable:
+		return n.Name
+	case *Selector:
+		if n.Optional {
+			return "(?. " + formatTestNode(n.X) + " " + n.Field + ")"
+		}
+		return "(. " + formatTestNode(n.X) + " " + n.Field + ")"
+	case *Index:
+		return "([] " + formatTestNode(n.X) + " " + formatTestNode(n.Index) + ")"
+	case *Unary:
+		return "(" + n.Op.String() + " " + formatTestNode(n.X) + ")"
+	case *Binary:
+		return "(" + n.Op.String() + " " + formatTestNode(n.X) + " " + formatTestNode(n.Y) + ")"
+	case *Ternary:
+		return "(? " + formatTestNode(n.Cond) + " " + formatTestNode(n.Then) + " " + formatTestNode(n.Else) + ")"
+	case *Call:
+		args := []string{n.Name, formatTestNode(n.Receiver)}
+		for _, arg := range n.Args {
+			args = append(args, formatTestNode(arg))
+		}
+		return "(call " + strings.Join(args, " ") + ")"
+	case *Array:
+		elems := make([]string, len(n.Elems))
+		for i, elem := range n.Elems {
+			elems[i] = formatTestNode(elem)
+		}
+		return "[" + strings.Join(elems, " ") + "]"
+	}
+	return fmt.Sprintf("unknown node %T", node)
+}
+
+func TestAST(t *testing.T) {
+	functions := map[string]ExprFunc{
+		"max": func(args ...interface{}) (interface{}, error) { return args[0], nil },
+	}
+	tests := []struct {
+		input    string
+		wanted   string
+		optimize bool
+	}{
+		{input: "a", wanted: "a"},
+		{input: "a.b.c", wanted: "(. (. a b) c)"},
+		{input: "a[0].b", wanted: "(. ([] a 0) b)"},
+		{input: "a.b[x.y + 1]", wanted: "([] (. a b) (+ (. x y) 1))"},
+		{input: "a?.b.c[0]", wanted: "([] (. (?. a b) c) 0)"},
+		{input: "!a && -b > 1", wanted: "(&& (! a) (> (- b) 1))"},
+		{input: "(1 + 2) * x", wanted: "(* (+ 1 2) x)"},
+		{input: "(1 + 2) * x", wanted: "(* 3 x)", optimize: true},
+		{input: "a ? b : c ? d : e", wanted: "(? a b (? c d e))"},
+		{input: "a ? b", wanted: "(? a b <nil>)"},
+		{input: "a ?? 'x'", wanted: "(?? a 120)"},
+		{input: `x not in ["a", y]`, wanted: `(not in x ["a" y])`},
+		{input: `x in ["a", "b"]`, wanted: `(in x [a b])`, optimize: true},
+		{input: "max(a, 2)", wanted: "(call max <nil> a 2)"},
+		{input: "u.Items(a)[0].b", wanted: "(. ([] (call Items u a) 0) b)"},
+		{input: "user.Orders(1).Total", wanted: "(. (call Orders user 1) Total)"},
+		{input: "u.p.Name().Upper()", wanted: "(call Upper (call Name (. u p)))"},
+		{input: "", wanted: "<nil>"},
+	}
+
+	for _, test := range tests {
+		opts := []Option{WithoutOptimization()}
+		if test.optimize {
+			opts = nil
+		}
+		expr, err := NewExprWithFunctions(test.input, functions, opts...)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		if res := formatTestNode(expr.AST()); res != test.wanted {
+			t.Errorf("input %s: ast %s does not match wanted: %s", test.input, res, test.wanted)
+		}
+	}
+}
+
+func TestASTSpans(t *testing.T) {
+	tests := []struct {
+		input  string
+		wanted []string
+	}{
+		{"a.b.c", []string{"a.b.c", "a.b", "a"}},
+		{"a[ i ].x + 1", []string{"a[ i ].x + 1", "a[ i ].x", "a[ i ]", "a", "i", "1"}},
+		{"u.F(x)?.y.z", []string{"u.F(x)?.y.z", "u.F(x)?.y", "u.F(x)", "u", "x"}},
+		{"m.Get(\"k\")[0]", []string{"m.Get(\"k\")[0]", "m.Get(\"k\")", "m", "\"k\"", "0"}},
+		{"!(é == 'é')\n|| b", []string{"!(é == 'é')\n|| b", "!(é == 'é')", "é == 'é'", "é", "'é'", "b"}},
+		{"c ? [1] : nil", []string{"c ? [1] : nil", "c", "[1]", "1", "nil"}},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExpr(test.input, WithoutOptimization())
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		var spans []string
+		Inspect(expr.AST(), func(node Node) bool {
+			if node != nil {
+				spans = append(spans, test.input[node.Pos().Offset:node.End().Offset])
+			}
+			return true
+		})
+		if !reflect.DeepEqual(spans, test.wanted) {
+			t.Errorf("input %s: spans %q do not match wanted: %q", test.input, spans, test.wanted)
+		}
+	}
+}
+
+type testVisitor struct {
+	depth  int
+	visits *[]string
+}
+
+func (v testVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		*v.visits = append(*v.visits, strings.Repeat(" ", v.depth-1)+"end")
+		return nil
+	}
+	*v.visits = append(*v.visits, strings.Repeat(" ", v.depth)+formatTestNode(node))
+	if _, ok := node.(*Call); ok {
+		// arguments are not visited
+		return nil
+	}
+	return testVisitor{depth: v.depth + 1, visits: v.visits}
+}
+
+func TestWalk(t *testing.T) {
+	expr, err := NewExpr("-a.b + x.Len(y)", WithoutOptimization())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var visits []string
+	Walk(testVisitor{visits: &visits}, expr.AST())
+	wanted := []string{
+		"(+ (- (. a b)) (call Len x y))",
+		" (- (. a b))",
+		"  (. a b)",
+		"   a",
+		"   end",
+		"  end",
+		" end",
+		" (call Len x y)",
+		"end",
+	}
+	if !reflect.DeepEqual(visits, wanted) {
+		t.Errorf("visits %q do not match wanted: %q", visits, wanted)
+	}
+
+	// Walk and Inspect do nothing on an empty expression
+	Inspect(nil, func(node Node) bool {
+		t.Errorf("node %v should not be inspected", node)
+		return true
+	})
+}
+
+func TestASTCopy(t *testing.T) {
+	expr, err := NewExpr(`x in [1, 2]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	array := expr.AST().(*Binary).Y.(*Literal)
+	array.Value.([]interface{})[0] = int64(3)
+	array.Value = nil
+
+	if res, err := expr.Eval(map[string]interface{}{"x": 1}); err != nil || res != true {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+}
@@ -1,6 +1,10 @@
 package goexpr
 
-import "testing"
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
 
 func BenchmarkRulengine(b *testing.B) {
 	benchmarks := []ParseAstTest{
@@ -57,3 +61,226 @@ func BenchmarkRulengine(b *testing.B) {
 		})
 	}
 }
+
+func BenchmarkLongExpr(b *testing.B) {
+	var arithmetic, logical, nested strings.Builder
+	// 1 + 2 * 3 - 4 / 5 + ..., 1201 tokens
+	arithmetic.WriteString("1")
+	ops := []string{"+", "*", "-", "/"}
+	for i := 0; i < 600; i++ {
+		fmt.Fprintf(&arithmetic, " %s %d", ops[i%len(ops)], i%9+1)
+	}
+	// x > 0 && x < 2 || ..., 1199 tokens
+	logical.WriteString("x > 0")
+	for i := 0; i < 150; i++ {
+		logical.WriteString(" && x < 2 || x > 0")
+	}
+	// (1 + (1 + (...))), 1201 tokens
+	nested.WriteString(strings.Repeat("(1 + ", 300))
+	nested.WriteString("0")
+	nested.WriteString(strings.Repeat(")", 300))
+
+	benchmarks := []ParseAstTest{
+		{
+			Name:  "arithmetic",
+			Input: arithmetic.String(),
+		},
+		{
+			Name:   "logical",
+			Input:  logical.String(),
+			Params: map[string]interface{}{"x": 1},
+		},
+		{
+			Name:  "nested",
+			Input: nested.String(),
+		},
+	}
+
+	for _, benchmark := range benchmarks {
+		expr, err := NewExpr(benchmark.Input)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(expr.tokens) < 1000 {
+			b.Fatalf("%s has only %d tokens", benchmark.Name, len(expr.tokens))
+		}
+
+		b.Run(benchmark.Name+"_parsing", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				NewExpr(benchmark.Input)
+			}
+		})
+
+		b.Run(benchmark.Name+"_eval", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				expr.Eval(benchmark.Params)
+			}
+		})
+	}
+}
+
+// BenchmarkEvalProgram compares the compiled program run by Eval with the tree walker,
+// constant subtrees are kept so that both evaluate the whole expression
+func BenchmarkEvalProgram(b *testing.B) {
+	benchmarks := []ParseAstTest{
+		{
+			Name:  "modifier",
+			Input: "(2) + (2) == (4)",
+		},
+		{
+			Name:  "parameter",
+			Input: "param1 < param2 && param3 == \"value\"",
+			Params: map[string]interface{}{
+				"param1": 1,
+				"param2": 2,
+				"param3": "value",
+			},
+		},
+		{
+			Name:  "ternary",
+			Input: "x > 50 ? \"big\" : x > 20 ? \"mid\" : \"small\"",
+			Params: map[string]interface{}{
+				"x": 30,
+			},
+		},
+		{
+			Name:  "membership",
+			Input: "status in [\"active\", \"trial\"] || (code ?? 0) > 200",
+			Params: map[string]interface{}{
+				"status": "closed",
+				"code":   201,
+			},
+		},
+	}
+
+	for _, benchmark := range benchmarks {
+		expr, err := NewExpr(benchmark.Input, WithoutOptimization())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = expr.Eval(benchmark.Params); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(benchmark.Name+"_tree", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				expr.eval(expr.astNode, &evalContext{params: MapParameters(benchmark.Params)})
+			}
+		})
+
+		b.Run(benchmark.Name+"_program", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				expr.Eval(benchmark.Params)
+			}
+		})
+	}
+}
+
+// BenchmarkOptimization compares expressions with constant subtrees folded at compile time with the parsed ones
+func BenchmarkOptimization(b *testing.B) {
+	benchmarks := []ParseAstTest{
+		{
+			Name:  "modifier",
+			Input: "(2) + (2) == (4)",
+		},
+		{
+			Name:  "parameter",
+			Input: "elapsed > (60 * 60 * 24) && status in [\"active\", \"trial\"]",
+			Params: map[string]interface{}{
+				"elapsed": 90000,
+				"status":  "trial",
+			},
+		},
+		{
+			Name:  "short circuit",
+			Input: "(1 > 2) || param1 < param2",
+			Params: map[string]interface{}{
+				"param1": 1,
+				"param2": 2,
+			},
+		},
+	}
+
+	for _, benchmark := range benchmarks {
+		optimized, err := NewExpr(benchmark.Input)
+		if err != nil {
+			b.Fatal(err)
+		}
+		parsed, err := NewExpr(benchmark.Input, WithoutOptimization())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = optimized.Eval(benchmark.Params); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(benchmark.Name+"_parsed", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				parsed.Eval(benchmark.Params)
+			}
+		})
+
+		b.Run(benchmark.Name+"_optimized", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				optimized.Eval(benchmark.Params)
+			}
+		})
+	}
+}
+
+// BenchmarkEvalStruct compares the evaluation against a struct with the one against a map of the same values
+func BenchmarkEvalStruct(b *testing.B) {
+	type benchAddress struct {
+		City    string
+		Country string
+	}
+	type benchUser struct {
+		Name    string
+		Age     int
+		Address benchAddress
+	}
+	user := benchUser{Name: "leon", Age: 30, Address: benchAddress{City: "Paris", Country: "FR"}}
+	params := map[string]interface{}{
+		"Name":    user.Name,
+		"Age":     user.Age,
+		"Address": user.Address,
+	}
+	benchmarks := []ParseAstTest{
+		{
+			Name:  "field",
+			Input: "Age >= 18 && Name != \"\"",
+		},
+		{
+			Name:  "nested",
+			Input: "Address.City == \"Paris\" && Address.Country == \"FR\"",
+		},
+	}
+
+	for _, benchmark := range benchmarks {
+		expr, err := NewExpr(benchmark.Input)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = expr.EvalStruct(&user); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(benchmark.Name+"_map", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				expr.Eval(params)
+			}
+		})
+
+		b.Run(benchmark.Name+"_struct", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				expr.EvalStruct(&user)
+			}
+		})
+	}
+}
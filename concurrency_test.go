@@ -0,0 +1,247 @@
+package goexpr
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+type ConcurrentEvalTest struct {
+	Name   string
+	Input  string
+	Wanted func(x float64) interface{}
+}
+
+var concurrentEvalTests = []ConcurrentEvalTest{
+	{
+		Name:  "Ternary Chain",
+		Input: `x > 50 ? "big" : x > 20 ? "mid" : "small"`,
+		Wanted: func(x float64) interface{} {
+			switch {
+			case x > 50:
+				return "big"
+			case x > 20:
+				return "mid"
+			}
+			return "small"
+		},
+	},
+	{
+		Name:  "Ternary Without Else",
+		Input: "x > 50 ? x",
+		Wanted: func(x float64) interface{} {
+			if x > 50 {
+				return x
+			}
+			return nil
+		},
+	},
+	{
+		Name:  "Nested Ternary Clause",
+		Input: "(x > 50 ? 1 : 2) + (x > 20 ? 10 : 20)",
+		Wanted: func(x float64) interface{} {
+			res := int64(2)
+			if x > 50 {
+				res = 1
+			}
+			if x > 20 {
+				return res + 10
+			}
+			return res + 20
+		},
+	},
+	{
+		Name:  "Logical",
+		Input: "x > 20 && x < 50 || x == 99",
+		Wanted: func(x float64) interface{} {
+			return x > 20 && x < 50 || x == 99
+		},
+	},
+	{
+		Name:  "Arithmetic",
+		Input: "x * 2 + 1",
+		Wanted: func(x float64) interface{} {
+			return x*2 + 1
+		},
+	},
+}
+
+func TestConcurrentEvalSharedExpr(t *testing.T) {
+	const goroutines, iterations = 32, 200
+
+	for _, test := range concurrentEvalTests {
+		expr, err := NewExpr(test.Input)
+		if err != nil {
+			t.Fatalf("Test '%s' with input %s failed to parse: %s", test.Name, test.Input, err)
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int, test ConcurrentEvalTest) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					x := float64((g*iterations + i) % 100)
+					res, err := expr.Eval(map[string]interface{}{"x": x})
+					if err != nil {
+						t.Errorf("Test '%s' with x=%v failed: %s", test.Name, x, err)
+						return
+					}
+					if wanted := test.Wanted(x); res != wanted {
+						t.Errorf("Test '%s' with x=%v: result '%v' does not match wanted: '%v'", test.Name, x, res, wanted)
+						return
+					}
+				}
+			}(g, test)
+		}
+		wg.Wait()
+	}
+}
+
+func TestConcurrentEvalDistinctExprs(t *testing.T) {
+	const iterations = 500
+
+	exprs := make([]*Expr, len(concurrentEvalTests))
+	for i, test := range concurrentEvalTests {
+		expr, err := NewExpr(test.Input)
+		if err != nil {
+			t.Fatalf("Test '%s' with input %s failed to parse: %s", test.Name, test.Input, err)
+		}
+		exprs[i] = expr
+	}
+
+	var wg sync.WaitGroup
+	for i := range concurrentEvalTests {
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(expr *Expr, test ConcurrentEvalTest, g int) {
+				defer wg.Done()
+				for n := 0; n < iterations; n++ {
+					x := float64((g*7 + n) % 100)
+					res, err := expr.Eval(map[string]interface{}{"x": x})
+					if err != nil {
+						t.Errorf("Test '%s' with x=%v failed: %s", test.Name, x, err)
+						return
+					}
+					if wanted := test.Wanted(x); res != wanted {
+						t.Errorf("Test '%s' with x=%v: result '%v' does not match wanted: '%v'", test.Name, x, res, wanted)
+						return
+					}
+				}
+			}(exprs[i], concurrentEvalTests[i], g)
+		}
+	}
+	wg.Wait()
+}
+
+func TestConcurrentParseAndEval(t *testing.T) {
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				input := fmt.Sprintf("%d > 50 ? %d : %d > 20 ? 1 : 0", n, n, n)
+				expr, err := NewExpr(input)
+				if err != nil {
+					t.Errorf("input %s failed to parse: %s", input, err)
+					return
+				}
+				res, err := expr.Eval(nil)
+				if err != nil {
+					t.Errorf("input %s failed to eval: %s", input, err)
+					return
+				}
+				wanted := int64(0)
+				if n > 50 {
+					wanted = int64(n)
+				} else if n > 20 {
+					wanted = 1
+				}
+				if res != wanted {
+					t.Errorf("input %s: result '%v' does not match wanted: '%v'", input, res, wanted)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentDynamicPatterns(t *testing.T) {
+	expr, err := NewExpr("s =~ p")
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < maxCachedPatterns; n++ {
+				pattern := fmt.Sprintf("^%d-", (g*maxCachedPatterns+n)%(maxCachedPatterns*2))
+				res, err := expr.Eval(map[string]interface{}{"s": pattern[1:] + "x", "p": pattern})
+				if err != nil || res != true {
+					t.Errorf("pattern %s: result '%v' (error %v) does not match wanted: 'true'", pattern, res, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// errorParameters fail to resolve every parameter with the same error
+type errorParameters struct {
+	err error
+}
+
+func (p errorParameters) Get(path []string) (interface{}, error) {
+	return nil, p.err
+}
+
+type testFailing struct {
+	err error
+}
+
+func (f testFailing) Check() error {
+	return f.err
+}
+
+// an *Error returned by a resolver or a method is located by each evaluation without being modified
+func TestConcurrentSharedErrors(t *testing.T) {
+	shared := &Error{Kind: ErrUnknownParameter, Msg: "not found"}
+	first, err := NewExpr("a + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewExpr("1 +\nf.Check()")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				_, err := first.EvalWith(errorParameters{err: shared})
+				if e, ok := err.(*Error); !ok || e == shared || e.Pos.Column != 1 || e.Input != "a + 1" {
+					t.Errorf("error %#v should be a located copy", err)
+					return
+				}
+				_, err = second.Eval(map[string]interface{}{"f": testFailing{err: shared}})
+				if e, ok := err.(*Error); !ok || e == shared || e.Pos.Line != 2 || e.Input != "1 +\nf.Check()" {
+					t.Errorf("error %#v should be a located copy", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if shared.Pos.Line != 0 || shared.Input != "" {
+		t.Errorf("shared error %#v was modified", shared)
+	}
+}
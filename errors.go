@@ -0,0 +1,198 @@
+package goexpr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// kinds of errors, an *Error matches its kind with errors.Is:
+//
+//	if errors.Is(err, goexpr.ErrUnknownParameter) {
+//		...
+//	}
+var (
+	ErrSyntax           = errors.New("syntax error")
+	ErrUnknownParameter = errors.New("unknown parameter")
+	ErrTypeMismatch     = errors.New("type mismatch")
+	ErrIndexOutOfRange  = errors.New("index out of range")
+	ErrDivisionByZero   = errors.New("division by zero")
+	ErrIntegerOverflow  = errors.New("integer overflow")
+	ErrInvalidEncoding  = errors.New("invalid encoding")
+)
+
+// kinds of errors reporting an expression beyond its Limits, they all match ErrLimitExceeded as well
+var (
+	ErrLimitExceeded = errors.New("limit exceeded")
+	ErrInputTooLong  = errors.New("input too long")
+	ErrTooDeep       = errors.New("expression too deep")
+	ErrTooManyNodes  = errors.New("too many nodes")
+	ErrTooManySteps  = errors.New("too many evaluation steps")
+	ErrValueTooLarge = errors.New("value too large")
+)
+
+// Position is a location within the input of an expression
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in runes, starting at 1
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+// Error is returned when an expression fails to be parsed or evaluated,
+// Pos and End delimit the part of Input which caused the failure
+type Error struct {
+	Kind     error // one of the Err* kinds, nil if the failure has no specific kind
+	Msg      string
+	Op       string        // operator, function or method involved, if any
+	Operands []interface{} // values the operator was applied to, if any
+	Path     []string      // path of the parameter involved, if any
+	Input    string
+	Pos      Position
+	End      Position
+	Err      error // underlying error, if any
+}
+
+// newSyntaxError reports an expression which cannot be scanned or parsed
+func newSyntaxError(pos, end Position, format string, args ...interface{}) *Error {
+	return &Error{
+		Kind: ErrSyntax,
+		Msg:  fmt.Sprintf(format, args...),
+		Pos:  pos,
+		End:  end,
+	}
+}
+
+// newEvalError reports a failure of the operator op applied to operands,
+// it is located later by wrapError with the span of the node being evaluated
+func newEvalError(kind error, op interface{}, operands []interface{}, format string, args ...interface{}) *Error {
+	e := &Error{
+		Kind:     kind,
+		Msg:      fmt.Sprintf(format, args...),
+		Operands: operands,
+	}
+	if op != nil {
+		e.Op = fmt.Sprint(op)
+	}
+	return e
+}
+
+// newPathError reports a failure to access the parameter path
+func newPathError(kind error, path []string, format string, args ...interface{}) *Error {
+	return &Error{
+		Kind: kind,
+		Msg:  fmt.Sprintf(format, args...),
+		Path: path,
+	}
+}
+
+// newLimitError reports an expression beyond its Limits
+func newLimitError(kind error, pos, end Position, format string, args ...interface{}) *Error {
+	return &Error{
+		Kind: kind,
+		Msg:  fmt.Sprintf(format, args...),
+		Pos:  pos,
+		End:  end,
+	}
+}
+
+// wrapError locates err at the given span, unless it is already located
+func wrapError(err error, pos, end Position) *Error {
+	if e, ok := err.(*Error); ok {
+		if e.Pos.Line == 0 {
+			e.Pos, e.End = pos, end
+		}
+		return e
+	}
+	return &Error{
+		Msg: err.Error(),
+		Pos: pos,
+		End: end,
+		Err: err,
+	}
+}
+
+// copyError returns a copy of err if it is an *Error returned by a resolver or a method,
+// which is then located by wrapError and withInput without modifying an error shared by other evaluations
+func copyError(err error) error {
+	if e, ok := err.(*Error); ok {
+		c := *e
+		return &c
+	}
+	return err
+}
+
+// withInput attaches the input of the expression to err if it is an *Error
+func withInput(err error, input string) error {
+	if e, ok := err.(*Error); ok && e.Input == "" {
+		e.Input = input
+	}
+	return err
+}
+
+func (e *Error) Error() string {
+	if e.Pos.Line == 0 {
+		// the failure is not located within the input, such as an invalid encoding
+		return e.Msg
+	}
+	return fmt.Sprintf("%s (%v)", e.Msg, e.Pos)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of e, or ErrLimitExceeded for the kinds of limits
+func (e *Error) Is(target error) bool {
+	if e.Kind == nil {
+		return false
+	}
+	if target == ErrLimitExceeded {
+		switch e.Kind {
+		case ErrInputTooLong, ErrTooDeep, ErrTooManyNodes, ErrTooManySteps, ErrValueTooLarge:
+			return true
+		}
+	}
+	return e.Kind == target
+}
+
+// Snippet returns the line of the input where the error starts,
+// followed by a line underlining the faulty span with carets:
+//
+//	1 + "a" * 2
+//	    ^^^^^^^
+func (e *Error) Snippet() string {
+	lines := strings.Split(e.Input, "\n")
+	if e.Pos.Line < 1 || e.Pos.Line > len(lines) {
+		return ""
+	}
+	line := []rune(lines[e.Pos.Line-1])
+	start := e.Pos.Column - 1
+	if start > len(line) {
+		start = len(line)
+	}
+	end := len(line)
+	if e.End.Line == e.Pos.Line && e.End.Column-1 < end {
+		end = e.End.Column - 1
+	}
+	if end <= start {
+		end = start + 1
+	}
+
+	var b strings.Builder
+	b.WriteString(string(line))
+	b.WriteByte('\n')
+	// keep tabs so that carets are aligned whatever the tab width
+	for _, r := range line[:start] {
+		if r == '\t' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString(strings.Repeat("^", end-start))
+	return b.String()
+}
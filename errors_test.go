@@ -0,0 +1,287 @@
+package goexpr
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type ErrorPositionTest struct {
+	Name    string
+	Input   string
+	Params  map[string]interface{}
+	Pos     Position
+	End     Position
+	Snippet string
+}
+
+func TestErrorPositions(t *testing.T) {
+	errorPositionTests := []ErrorPositionTest{
+		{
+			Name:    "Invalid Token",
+			Input:   "1 @ 2",
+			Pos:     Position{Offset: 2, Line: 1, Column: 3},
+			End:     Position{Offset: 3, Line: 1, Column: 4},
+			Snippet: "1 @ 2\n  ^",
+		},
+		{
+			Name:    "Unclosed String",
+			Input:   `1 + "abc`,
+			Pos:     Position{Offset: 4, Line: 1, Column: 5},
+			End:     Position{Offset: 8, Line: 1, Column: 9},
+			Snippet: "1 + \"abc\n    ^^^^",
+		},
+		{
+			Name:    "Unclosed Parenthesis",
+			Input:   "(1 + 2",
+			Pos:     Position{Offset: 0, Line: 1, Column: 1},
+			End:     Position{Offset: 1, Line: 1, Column: 2},
+			Snippet: "(1 + 2\n^",
+		},
+		{
+			Name:    "Unexpected End",
+			Input:   "1 +",
+			Pos:     Position{Offset: 3, Line: 1, Column: 4},
+			End:     Position{Offset: 3, Line: 1, Column: 4},
+			Snippet: "1 +\n   ^",
+		},
+		{
+			Name:    "Unexpected Token",
+			Input:   "1 2",
+			Pos:     Position{Offset: 2, Line: 1, Column: 3},
+			End:     Position{Offset: 3, Line: 1, Column: 4},
+			Snippet: "1 2\n  ^",
+		},
+		{
+			Name:    "Undefined Function",
+			Input:   "1 + foo(1)",
+			Pos:     Position{Offset: 4, Line: 1, Column: 5},
+			End:     Position{Offset: 7, Line: 1, Column: 8},
+			Snippet: "1 + foo(1)\n    ^^^",
+		},
+		{
+			Name:    "Type Mismatch",
+			Input:   `1 + x * "s"`,
+			Params:  map[string]interface{}{"x": 1},
+			Pos:     Position{Offset: 4, Line: 1, Column: 5},
+			End:     Position{Offset: 11, Line: 1, Column: 12},
+			Snippet: "1 + x * \"s\"\n    ^^^^^^^",
+		},
+		{
+			Name:    "Type Mismatch On Second Line",
+			Input:   "1 +\n\tx * \"s\"",
+			Params:  map[string]interface{}{"x": 1},
+			Pos:     Position{Offset: 5, Line: 2, Column: 2},
+			End:     Position{Offset: 12, Line: 2, Column: 9},
+			Snippet: "\tx * \"s\"\n\t^^^^^^^",
+		},
+		{
+			Name:    "Missing Parameter",
+			Input:   "x > 1 && y.z > 1",
+			Params:  map[string]interface{}{"x": 2},
+			Pos:     Position{Offset: 9, Line: 1, Column: 10},
+			End:     Position{Offset: 12, Line: 1, Column: 13},
+			Snippet: "x > 1 && y.z > 1\n         ^^^",
+		},
+		{
+			Name:    "Non Bool Condition",
+			Input:   `x ? 1 : 2`,
+			Params:  map[string]interface{}{"x": 3},
+			Pos:     Position{Offset: 0, Line: 1, Column: 1},
+			End:     Position{Offset: 1, Line: 1, Column: 2},
+			Snippet: "x ? 1 : 2\n^",
+		},
+	}
+
+	for _, test := range errorPositionTests {
+		expr, err := NewExpr(test.Input)
+		if err == nil {
+			_, err = expr.Eval(test.Params)
+		}
+		var exprErr *Error
+		if !errors.As(err, &exprErr) {
+			t.Errorf("Test '%s' with input %q: error %v is not an *Error", test.Name, test.Input, err)
+			continue
+		}
+		if exprErr.Input != test.Input {
+			t.Errorf("Test '%s': input %q does not match wanted: %q", test.Name, exprErr.Input, test.Input)
+		}
+		if exprErr.Pos != test.Pos || exprErr.End != test.End {
+			t.Errorf("Test '%s' with input %q: span %+v-%+v does not match wanted: %+v-%+v", test.Name, test.Input, exprErr.Pos, exprErr.End, test.Pos, test.End)
+		}
+		if snippet := exprErr.Snippet(); snippet != test.Snippet {
+			t.Errorf("Test '%s' with input %q: snippet\n%s\ndoes not match wanted:\n%s", test.Name, test.Input, snippet, test.Snippet)
+		}
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	expr, err := NewExprWithFunctions("1 + fail()", testFunctions)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	_, err = expr.Eval(nil)
+	if !errors.Is(err, errTestFunction) {
+		t.Errorf("error %v should wrap %v", err, errTestFunction)
+	}
+	var exprErr *Error
+	if !errors.As(err, &exprErr) || exprErr.Pos.Column != 5 {
+		t.Errorf("error %v should be located at column 5", err)
+	}
+}
+
+type ErrorKindTest struct {
+	Name     string
+	Input    string
+	Params   map[string]interface{}
+	Kind     error
+	Op       string
+	Operands []interface{}
+	Path     []string
+}
+
+func TestErrorKinds(t *testing.T) {
+	params := map[string]interface{}{
+		"x":    int64(1),
+		"min":  int64(math.MinInt64),
+		"s":    "abc",
+		"list": []int{1, 2},
+		"user": map[string]interface{}{"name": "Bob"},
+	}
+	errorKindTests := []ErrorKindTest{
+		{
+			Name:  "Syntax",
+			Input: "1 +",
+			Kind:  ErrSyntax,
+		},
+		{
+			Name:  "Invalid Token",
+			Input: "1 @ 2",
+			Kind:  ErrSyntax,
+		},
+		{
+			Name:  "Unknown Parameter",
+			Input: "y > 1",
+			Kind:  ErrUnknownParameter,
+			Path:  []string{"y"},
+		},
+		{
+			Name:  "Unknown Key",
+			Input: "user.age > 1",
+			Kind:  ErrUnknownParameter,
+			Path:  []string{"user", "age"},
+		},
+		{
+			Name:     "Numeric Type Mismatch",
+			Input:    "x * s",
+			Kind:     ErrTypeMismatch,
+			Op:       "*",
+			Operands: []interface{}{int64(1), "abc"},
+		},
+		{
+			Name:     "Prefix Type Mismatch",
+			Input:    "!x",
+			Kind:     ErrTypeMismatch,
+			Op:       "!",
+			Operands: []interface{}{int64(1)},
+		},
+		{
+			Name:     "Ternary Type Mismatch",
+			Input:    "x ? 1 : 2",
+			Kind:     ErrTypeMismatch,
+			Op:       "?",
+			Operands: []interface{}{int64(1)},
+		},
+		{
+			Name:  "Index Out Of Range",
+			Input: "list[2] > 0",
+			Kind:  ErrIndexOutOfRange,
+			Path:  []string{"list", "2"},
+		},
+		{
+			Name:  "Fractional Index",
+			Input: "list[1.5] > 0",
+			Kind:  ErrTypeMismatch,
+			Path:  []string{"list"},
+		},
+		{
+			Name:  "Computed Fractional Index",
+			Input: "list[x / 2.0] > 0",
+			Kind:  ErrTypeMismatch,
+			Path:  []string{"list"},
+		},
+		{
+			Name:  "Float Index Out Of Int Range",
+			Input: "list[10000000000000000000.0]",
+			Kind:  ErrTypeMismatch,
+			Path:  []string{"list"},
+		},
+		{
+			Name:  "String Index Out Of Range",
+			Input: "s[3] == 'c'",
+			Kind:  ErrIndexOutOfRange,
+			Path:  []string{"s", "3"},
+		},
+		{
+			Name:     "Division By Zero",
+			Input:    "x / (x - 1)",
+			Kind:     ErrDivisionByZero,
+			Op:       "/",
+			Operands: []interface{}{int64(1), int64(0)},
+		},
+		{
+			Name:     "Integer Overflow",
+			Input:    "9223372036854775807 + x",
+			Kind:     ErrIntegerOverflow,
+			Op:       "+",
+			Operands: []interface{}{int64(9223372036854775807), int64(1)},
+		},
+		{
+			Name:     "Negation Overflow",
+			Input:    "-min",
+			Kind:     ErrIntegerOverflow,
+			Op:       "-",
+			Operands: []interface{}{int64(math.MinInt64)},
+		},
+		{
+			Name:     "Shift Overflow",
+			Input:    "x << 63",
+			Kind:     ErrIntegerOverflow,
+			Op:       "<<",
+			Operands: []interface{}{int64(1), int64(63)},
+		},
+		{
+			Name:     "Negative Shift Count",
+			Input:    "x >> (x - 2)",
+			Kind:     ErrIntegerOverflow,
+			Op:       ">>",
+			Operands: []interface{}{int64(1), int64(-1)},
+		},
+	}
+
+	for _, test := range errorKindTests {
+		expr, err := NewExpr(test.Input)
+		if err == nil {
+			_, err = expr.Eval(params)
+		}
+		if !errors.Is(err, test.Kind) {
+			t.Errorf("Test '%s' with input %s: error %v is not %v", test.Name, test.Input, err, test.Kind)
+			continue
+		}
+		var exprErr *Error
+		if !errors.As(err, &exprErr) {
+			t.Errorf("Test '%s' with input %s: error %v is not an *Error", test.Name, test.Input, err)
+			continue
+		}
+		if exprErr.Op != test.Op {
+			t.Errorf("Test '%s': operator '%s' does not match wanted: '%s'", test.Name, exprErr.Op, test.Op)
+		}
+		if !reflect.DeepEqual(exprErr.Operands, test.Operands) {
+			t.Errorf("Test '%s': operands %v do not match wanted: %v", test.Name, exprErr.Operands, test.Operands)
+		}
+		if !reflect.DeepEqual(exprErr.Path, test.Path) {
+			t.Errorf("Test '%s': path %v does not match wanted: %v", test.Name, exprErr.Path, test.Path)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package goexpr
+
+import "strings"
+
+// Reason is a clause of a boolean expression which is responsible for its outcome, returned by Explain,
+// such as the comparison age >= 18 of age >= 18 && country == "FR" when age is 17
+type Reason struct {
+	Node     Node        // node of the clause within the syntax tree returned by AST
+	Op       string      // operator, function or method of the clause, empty for a parameter or a literal
+	Text     string      // source of the clause within the input
+	Value    interface{} // value of the clause
+	Operands []*Trace    // evaluation of the operands of the clause, such as age and 18 of age >= 18
+}
+
+// String tells the reason in plain words, giving the values of the operands which are not literals:
+//
+//	age (17) >= 18 was false
+func (r Reason) String() string {
+	var s string
+	if _, ok := r.Node.(*Binary); ok && len(r.Operands) == 2 {
+		s = reasonOperand(r.Operands[0]) + " " + r.Op + " " + reasonOperand(r.Operands[1])
+	} else {
+		s = strings.Join(strings.Fields(r.Text), " ")
+	}
+	return s + " was " + traceValue(r.Value)
+}
+
+func reasonOperand(t *Trace) string {
+	s := strings.Join(strings.Fields(t.Text), " ")
+	if _, ok := t.Node.(*Literal); ok {
+		return s
+	}
+	return s + " (" + traceValue(t.Value) + ")"
+}
+
+// Explain evaluates a boolean expression like Eval, and returns the clauses responsible for its outcome:
+// through &&, ||, !, ?: and ??, only the operands which decide the outcome are kept,
+// such as the first false operand of a false &&, or both operands of a true &&.
+// it fails with an error matching ErrTypeMismatch when the outcome is not a bool
+func (expr *Expr) Explain(params map[string]interface{}) (bool, []Reason, error) {
+	res, trace, err := expr.EvalTrace(params)
+	if err != nil {
+		return false, nil, err
+	}
+	outcome, ok := res.(bool)
+	if !ok {
+		e := &Error{
+			Kind:     ErrTypeMismatch,
+			Msg:      "value '" + traceValue(res) + "' of the expression is not a bool",
+			Operands: []interface{}{res},
+			Input:    expr.input,
+		}
+		if trace != nil {
+			e.Pos, e.End = trace.Node.Pos(), trace.Node.End()
+		}
+		return false, nil, e
+	}
+	return outcome, explain(trace), nil
+}
+
+// explain returns the clauses responsible for the value of the evaluated node t
+func explain(t *Trace) []Reason {
+	switch n := t.Node.(type) {
+	case *Binary:
+		left, right := t.Children[0], t.Children[1]
+		switch n.Op {
+		case LAND, LOR:
+			// the value of a && b is decided by a alone when it is false, otherwise by both,
+			// and conversely for a || b
+			decisive := n.Op == LOR
+			if t.Value == decisive {
+				if left.Value == decisive {
+					return explain(left)
+				}
+				return explain(right)
+			}
+			return append(explain(left), explain(right)...)
+		case COALESCE:
+			if left.Err == nil && !isNil(left.Value) {
+				return explain(left)
+			}
+			return explain(right)
+		}
+	case *Unary:
+		if n.Op == NOT {
+			return explain(t.Children[0])
+		}
+	case *Ternary:
+		// the condition chooses the branch which gives the value
+		reasons := explain(t.Children[0])
+		for _, branch := range t.Children[1:] {
+			if !branch.ShortCircuited {
+				reasons = append(reasons, explain(branch)...)
+			}
+		}
+		return reasons
+	}
+	return []Reason{{
+		Node:     t.Node,
+		Op:       t.Op,
+		Text:     t.Text,
+		Value:    t.Value,
+		Operands: t.Children,
+	}}
+}
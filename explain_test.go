@@ -0,0 +1,137 @@
+package goexpr
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		input   string
+		params  map[string]interface{}
+		outcome bool
+		wanted  []string
+	}{
+		{
+			input:   `age >= 18 && country == "FR"`,
+			params:  map[string]interface{}{"age": 17, "country": "FR"},
+			outcome: false,
+			wanted:  []string{"age (17) >= 18 was false"},
+		},
+		{
+			input:   `age >= 18 && country == "FR"`,
+			params:  map[string]interface{}{"age": 20, "country": "DE"},
+			outcome: false,
+			wanted:  []string{`country ("DE") == "FR" was false`},
+		},
+		{
+			input:   `age >= 18 && country == "FR"`,
+			params:  map[string]interface{}{"age": 20, "country": "FR"},
+			outcome: true,
+			wanted:  []string{"age (20) >= 18 was true", `country ("FR") == "FR" was true`},
+		},
+		{
+			input:   "!(banned || age < 18)",
+			params:  map[string]interface{}{"banned": false, "age": 20},
+			outcome: true,
+			wanted:  []string{"banned was false", "age (20) < 18 was false"},
+		},
+		{
+			input:   "vip || total > 100 && !blocked",
+			params:  map[string]interface{}{"vip": false, "total": 150.5, "blocked": false},
+			outcome: true,
+			wanted:  []string{"total (150.5) > 100 was true", "blocked was false"},
+		},
+		{
+			input:   "vip || (total > 100 && !blocked)",
+			params:  map[string]interface{}{"vip": true},
+			outcome: true,
+			wanted:  []string{"vip was true"},
+		},
+		{
+			input:   "premium ? total > 50 : total > 100",
+			params:  map[string]interface{}{"premium": true, "total": 70},
+			outcome: true,
+			wanted:  []string{"premium was true", "total (70) > 50 was true"},
+		},
+		{
+			input:   "override ?? score >= 0.5",
+			params:  map[string]interface{}{"override": nil, "score": 0.25},
+			outcome: false,
+			wanted:  []string{"score (0.25) >= 0.5 was false"},
+		},
+		{
+			input:   "user.name =~ `^a` || user.tags[0] in [\"x\", \"y\"]",
+			params:  map[string]interface{}{"user": map[string]interface{}{"name": "bob", "tags": []interface{}{"z"}}},
+			outcome: false,
+			wanted:  []string{"user.name (\"bob\") =~ `^a` was false", `user.tags[0] ("z") in ["x", "y"] was false`},
+		},
+		{
+			input:   "bob.IsAdult() || 1 + 1 == 3",
+			params:  map[string]interface{}{"bob": &testUser{Age: 12}},
+			outcome: false,
+			wanted:  []string{"bob.IsAdult() was false", "1 + 1 == 3 was false"},
+		},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExpr(test.input)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		outcome, reasons, err := expr.Explain(test.params)
+		if err != nil {
+			t.Errorf("input %s failed: %s", test.input, err)
+			continue
+		}
+		if outcome != test.outcome {
+			t.Errorf("input %s: outcome %v should be %v", test.input, outcome, test.outcome)
+		}
+		var res []string
+		for _, reason := range reasons {
+			res = append(res, reason.String())
+		}
+		if !reflect.DeepEqual(res, test.wanted) {
+			t.Errorf("input %s: reasons %q do not match wanted: %q", test.input, res, test.wanted)
+		}
+	}
+}
+
+func TestExplainReason(t *testing.T) {
+	expr, err := NewExpr("age >= 18 && ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, reasons, err := expr.Explain(map[string]interface{}{"age": 17, "ok": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reasons) != 1 {
+		t.Fatalf("reasons %v should be a single comparison", reasons)
+	}
+	r := reasons[0]
+	if r.Op != ">=" || r.Text != "age >= 18" || r.Value != false || r.Node.Pos().Column != 1 {
+		t.Errorf("reason %+v does not match age >= 18", r)
+	}
+	if len(r.Operands) != 2 || r.Operands[0].Text != "age" || r.Operands[0].Value != int64(17) || r.Operands[1].Value != int64(18) {
+		t.Errorf("operands %v of the reason do not match age and 18", r.Operands)
+	}
+
+	// the outcome must be a bool
+	expr, err = NewExpr("age + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = expr.Explain(map[string]interface{}{"age": 17}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("error %v should be a type mismatch", err)
+	}
+	expr, err = NewExpr("age > 1 && missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = expr.Explain(map[string]interface{}{"age": 17}); !errors.Is(err, ErrUnknownParameter) {
+		t.Errorf("error %v should be an unknown parameter", err)
+	}
+}
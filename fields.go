@@ -0,0 +1,161 @@
+package goexpr
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldNaming tells how the fields of structs are named within expressions
+type fieldNaming struct {
+	tag      string // key of the tag naming fields, such as json, fields without the tag keep their Go name
+	foldCase bool   // names match fields regardless of their case
+}
+
+// name returns the name of the field f, which is empty when the field has no name:
+// the tag is "-", or the field is an untagged embedded struct. promoted tells whether the fields
+// of f are promoted, which they are when f is an embedded struct not named by its tag
+func (naming fieldNaming) name(f reflect.StructField) (name string, promoted bool) {
+	embedded := f.Anonymous && indirect(f.Type).Kind() == reflect.Struct
+	if naming.tag == "" {
+		return f.Name, embedded
+	}
+
+	name, ok := naming.tagName(f)
+	if !ok {
+		return "", false
+	}
+	if name != "" {
+		return name, false
+	}
+	// the fields of an untagged embedded struct are promoted, as encoding/json does
+	if embedded {
+		return "", true
+	}
+	return f.Name, false
+}
+
+// tagName returns the name given by the tag of f, which is empty when the tag does not name f,
+// it is false when the tag is "-"
+func (naming fieldNaming) tagName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get(naming.tag)
+	if tag == "-" {
+		return "", false
+	}
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag, true
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// structFields maps the names of the exported fields of a struct type to their index path,
+// fields promoted from embedded structs are included
+type structFields struct {
+	names  map[string][]int
+	folded map[string][]int // by lower-cased names when the case is ignored
+}
+
+type fieldKey struct {
+	t      reflect.Type
+	naming fieldNaming
+}
+
+// fieldCache holds the structFields of every struct type met, so that fields
+// are looked up by their name with reflection only once per type
+var fieldCache sync.Map // fieldKey -> *structFields
+
+// cachedFields returns the fields of the struct type t named as told by naming
+func cachedFields(t reflect.Type, naming fieldNaming) *structFields {
+	key := fieldKey{t: t, naming: naming}
+	if fields, ok := fieldCache.Load(key); ok {
+		return fields.(*structFields)
+	}
+	fields, _ := fieldCache.LoadOrStore(key, newStructFields(t, naming))
+	return fields.(*structFields)
+}
+
+// newStructFields follows the rules of reflect.Type.FieldByName applied to the names given by naming:
+// a field hides the fields with the same name promoted from deeper embedded structs,
+// ambiguous fields are not visible
+func newStructFields(t reflect.Type, naming fieldNaming) *structFields {
+	candidates := map[string][][]int{}
+	collectFields(t, naming, nil, map[reflect.Type]bool{t: true}, candidates)
+
+	fields := &structFields{
+		names: dominantFields(candidates),
+	}
+	if naming.foldCase {
+		folded := map[string][][]int{}
+		for name, indexes := range candidates {
+			folded[strings.ToLower(name)] = append(folded[strings.ToLower(name)], indexes...)
+		}
+		fields.folded = dominantFields(folded)
+	}
+	return fields
+}
+
+// collectFields adds the exported fields of the struct type t found at index to candidates,
+// and walks through the embedded structs which are not visited yet
+func collectFields(t reflect.Type, naming fieldNaming, index []int, visited map[reflect.Type]bool, candidates map[string][][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fieldIndex := append(index[:len(index):len(index)], i)
+		name, promoted := naming.name(f)
+		if name != "" && f.IsExported() {
+			candidates[name] = append(candidates[name], fieldIndex)
+		}
+		if embedded := indirect(f.Type); promoted && !visited[embedded] {
+			visited[embedded] = true
+			collectFields(embedded, naming, fieldIndex, visited, candidates)
+			delete(visited, embedded)
+		}
+	}
+}
+
+// dominantFields keeps the shallowest field of each name, unless there are several of them
+func dominantFields(candidates map[string][][]int) map[string][]int {
+	fields := make(map[string][]int, len(candidates))
+	for name, indexes := range candidates {
+		var dominant []int
+		ambiguous := false
+		for _, index := range indexes {
+			if dominant == nil || len(index) < len(dominant) {
+				dominant, ambiguous = index, false
+			} else if len(index) == len(dominant) {
+				ambiguous = true
+			}
+		}
+		if !ambiguous {
+			fields[name] = dominant
+		}
+	}
+	return fields
+}
+
+// field returns the field name of the struct value v, which is of the type of fields,
+// an exact name is preferred to a name of another case.
+// it fails when the field is promoted from an embedded struct through a nil pointer
+func (fields *structFields) field(v reflect.Value, name string) (reflect.Value, bool, error) {
+	index, ok := fields.names[name]
+	if !ok && fields.folded != nil {
+		index, ok = fields.folded[strings.ToLower(name)]
+	}
+	if !ok {
+		return reflect.Value{}, false, nil
+	}
+	if len(index) == 1 {
+		return v.Field(index[0]), true, nil
+	}
+	field, err := v.FieldByIndexErr(index)
+	if err != nil {
+		return reflect.Value{}, false, err
+	}
+	return field, true, nil
+}
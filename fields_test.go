@@ -0,0 +1,136 @@
+package goexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testBase struct {
+	ID   int
+	Name string
+}
+
+type testOther struct {
+	ID    int
+	Other string
+}
+
+type testAccount struct {
+	testBase
+	*testOther
+	Name   string
+	Owner  testUser
+	secret string
+}
+
+func TestStructFields(t *testing.T) {
+	fields := cachedFields(reflect.TypeOf(testAccount{}), fieldNaming{})
+	// ID is ambiguous, Name of testBase is hidden, secret and the embedded structs are not exported
+	wanted := map[string][]int{
+		"Name":  {2},
+		"Owner": {3},
+		"Other": {1, 1},
+	}
+	if !reflect.DeepEqual(fields.names, wanted) {
+		t.Errorf("fields %v do not match wanted: %v", fields, wanted)
+	}
+
+	if cachedFields(reflect.TypeOf(testAccount{}), fieldNaming{}) != fields {
+		t.Errorf("fields of the same type are computed twice")
+	}
+}
+
+func TestStructFieldsPromoted(t *testing.T) {
+	type testWrapper struct {
+		testBase
+		Extra bool
+	}
+	v := reflect.ValueOf(testWrapper{testBase: testBase{ID: 1, Name: "base"}})
+	fields := cachedFields(v.Type(), fieldNaming{})
+	for name, wanted := range map[string]interface{}{"ID": 1, "Name": "base", "Extra": false} {
+		field, ok, err := fields.field(v, name)
+		if err != nil || !ok {
+			t.Errorf("field %s not found: %v", name, err)
+			continue
+		}
+		if field.Interface() != wanted {
+			t.Errorf("field %s is %v, wanted %v", name, field.Interface(), wanted)
+		}
+	}
+	if _, ok, _ := fields.field(v, "testBase"); ok {
+		t.Errorf("unexported embedded struct must not be a field")
+	}
+}
+
+func TestStructFieldsNilEmbedded(t *testing.T) {
+	v := reflect.ValueOf(testAccount{})
+	if _, _, err := cachedFields(v.Type(), fieldNaming{}).field(v, "Other"); err == nil {
+		t.Errorf("field promoted through a nil pointer must fail")
+	}
+}
+
+type testTagged struct {
+	testBase `json:"base"`
+	*testOther
+	UserID   int    `json:"user_id,omitempty" expr:"uid"`
+	Email    string `json:",omitempty"`
+	Password string `json:"-"`
+	Nickname string
+	NickName string
+}
+
+func TestStructFieldsNaming(t *testing.T) {
+	tests := []struct {
+		naming fieldNaming
+		wanted map[string][]int
+	}{
+		{
+			fieldNaming{},
+			map[string][]int{"Name": {0, 1}, "UserID": {2}, "Email": {3}, "Password": {4}, "Nickname": {5}, "NickName": {6}, "Other": {1, 1}},
+		},
+		{
+			// testBase is named by its tag but not exported, ID of testOther is not ambiguous anymore
+			fieldNaming{tag: "json"},
+			map[string][]int{"user_id": {2}, "Email": {3}, "Nickname": {5}, "NickName": {6}, "ID": {1, 0}, "Other": {1, 1}},
+		},
+		{
+			fieldNaming{tag: "expr"},
+			map[string][]int{"Name": {0, 1}, "uid": {2}, "Email": {3}, "Password": {4}, "Nickname": {5}, "NickName": {6}, "Other": {1, 1}},
+		},
+	}
+
+	for _, test := range tests {
+		fields := cachedFields(reflect.TypeOf(testTagged{}), test.naming)
+		if !reflect.DeepEqual(fields.names, test.wanted) {
+			t.Errorf("fields %v named by %+v do not match wanted: %v", fields.names, test.naming, test.wanted)
+		}
+	}
+}
+
+func TestStructFieldsFoldCase(t *testing.T) {
+	v := reflect.ValueOf(testTagged{UserID: 1, Email: "a@b.c", Nickname: "x", NickName: "y"})
+	fields := cachedFields(v.Type(), fieldNaming{tag: "json", foldCase: true})
+	tests := []struct {
+		name   string
+		wanted interface{}
+	}{
+		{"user_id", 1},
+		{"USER_ID", 1},
+		{"email", "a@b.c"},
+		{"Nickname", "x"},
+		{"NickName", "y"},
+		{"nickname", nil},
+		{"password", nil},
+	}
+
+	for _, test := range tests {
+		field, ok, err := fields.field(v, test.name)
+		if err != nil {
+			t.Errorf("field %s failed: %v", test.name, err)
+		} else if !ok && test.wanted != nil {
+			t.Errorf("field %s not found", test.name)
+		} else if ok && (test.wanted == nil || field.Interface() != test.wanted) {
+			t.Errorf("field %s is %v, wanted %v", test.name, field.Interface(), test.wanted)
+		}
+	}
+}
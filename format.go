@@ -0,0 +1,216 @@
+package goexpr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// String returns the expression formatted as by Format, from the tree which is evaluated:
+// constant subtrees are folded unless WithoutOptimization is given
+func (expr *Expr) String() string {
+	var b strings.Builder
+	formatNode(&b, expr.AST())
+	return b.String()
+}
+
+// Format returns the expression with canonical spacing and without needless parentheses,
+// NewExpr(Format(expr)) evaluates as NewExpr(expr) does. functions do not need to be registered
+func Format(expr string) (string, error) {
+	tokens, err := lexerScan(expr)
+	if err != nil {
+		return "", withInput(err, expr)
+	}
+	root, err := parseAST(tokens, nil, nil)
+	if err != nil {
+		return "", withInput(err, expr)
+	}
+
+	var b strings.Builder
+	formatNode(&b, exporter{input: expr}.export(root))
+	return b.String(), nil
+}
+
+// formatNode writes node into b, operands are enclosed in parentheses only when
+// their operator has a lower priority than the operator applied to them
+func formatNode(b *strings.Builder, node Node) {
+	switch n := node.(type) {
+	case *Literal:
+		formatValue(b, n.Value)
+	case *Variable:
+		b.WriteString(n.Name)
+	case *Selector:
+		formatNode(b, n.X)
+		if n.Optional {
+			b.WriteString("?.")
+		} else {
+			b.WriteByte('.')
+		}
+		b.WriteString(n.Field)
+	case *Index:
+		formatNode(b, n.X)
+		b.WriteByte('[')
+		formatNode(b, n.Index)
+		b.WriteByte(']')
+	case *Unary:
+		b.WriteString(n.Op.String())
+		operand := formatString(n.X, priority(n.X) < priorityPREFIX || enclosedOperand(n.X))
+		switch {
+		case strings.HasPrefix(operand, "-"):
+			// a minus sign is not scanned after a prefix operator, as in - -x
+			operand = "(" + operand + ")"
+		case strings.HasPrefix(operand, "!"):
+			// !! would be scanned as a single operator
+			b.WriteByte(' ')
+		}
+		b.WriteString(operand)
+	case *Binary:
+		// operators with the same priority are folded to the left, e.g. a - (b - c) needs parentheses
+		p := n.Op.Priority()
+		formatOperand(b, n.X, priority(n.X) < p)
+		b.WriteString(" " + n.Op.String() + " ")
+		operand := formatString(n.Y, priority(n.Y) <= p)
+		if rule := lexerRules[n.Op]; strings.HasPrefix(operand, "-") && !rule.hasNextAllowable(NEG) {
+			// a minus sign is scanned as a subtraction after some operators, as in a << -1
+			operand = "(" + operand + ")"
+		}
+		b.WriteString(operand)
+	case *Ternary:
+		formatOperand(b, n.Cond, priority(n.Cond) <= priorityTENARY)
+		b.WriteString(" ? ")
+		// the else branch would be taken by a ternary without else within the then branch
+		formatOperand(b, n.Then, n.Else != nil && danglingTernary(n.Then))
+		if n.Else != nil {
+			b.WriteString(" : ")
+			formatNode(b, n.Else)
+		}
+	case *Call:
+		if n.Receiver != nil {
+			formatNode(b, n.Receiver)
+			b.WriteByte('.')
+		}
+		b.WriteString(n.Name)
+		b.WriteByte('(')
+		formatList(b, n.Args)
+		b.WriteByte(')')
+	case *Array:
+		b.WriteByte('[')
+		formatList(b, n.Elems)
+		b.WriteByte(']')
+	}
+}
+
+func formatOperand(b *strings.Builder, node Node, parenthesized bool) {
+	if parenthesized {
+		b.WriteByte('(')
+		formatNode(b, node)
+		b.WriteByte(')')
+		return
+	}
+	formatNode(b, node)
+}
+
+func formatString(node Node, parenthesized bool) string {
+	var b strings.Builder
+	formatOperand(&b, node, parenthesized)
+	return b.String()
+}
+
+func formatList(b *strings.Builder, nodes []Node) {
+	for i, node := range nodes {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		formatNode(b, node)
+	}
+}
+
+// priority returns the priority of the operator of node, operands are of the highest priority
+func priority(node Node) opPriority {
+	switch n := node.(type) {
+	case *Binary:
+		return n.Op.Priority()
+	case *Unary:
+		return priorityPREFIX
+	case *Ternary:
+		return priorityTENARY
+	}
+	return priorityLITERAL
+}
+
+// enclosedOperand reports whether node keeps its parentheses after a prefix operator,
+// strings, runes, nil and arrays are not operands of - and !, as in -("x")
+func enclosedOperand(node Node) bool {
+	switch n := node.(type) {
+	case *Literal:
+		switch n.Value.(type) {
+		case int64, float64, bool:
+			return false
+		}
+		return true
+	case *Array:
+		return true
+	}
+	return false
+}
+
+// danglingTernary reports whether node ends with a ternary without else
+func danglingTernary(node Node) bool {
+	t, ok := node.(*Ternary)
+	if !ok {
+		return false
+	}
+	if t.Else == nil {
+		return true
+	}
+	return danglingTernary(t.Else)
+}
+
+// formatValue writes the literal value so that it is scanned back into the same value
+func formatValue(b *strings.Builder, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		b.WriteString("nil")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case int64:
+		if v == math.MinInt64 {
+			// the opposite of math.MinInt64 does not fit into an int64
+			b.WriteString("(-9223372036854775807 - 1)")
+			return
+		}
+		b.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			b.WriteString("(1.0 / 0)")
+		case math.IsInf(v, -1):
+			b.WriteString("(-1.0 / 0)")
+		case math.IsNaN(v):
+			b.WriteString("(0.0 / 0)")
+		default:
+			s := strconv.FormatFloat(v, 'f', -1, 64)
+			if !strings.Contains(s, ".") {
+				// without a dot, the number would be scanned into an int64
+				s += ".0"
+			}
+			b.WriteString(s)
+		}
+	case string:
+		b.WriteString(strconv.Quote(v))
+	case rune:
+		b.WriteString(strconv.QuoteRune(v))
+	case []interface{}:
+		b.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			formatValue(b, elem)
+		}
+		b.WriteByte(']')
+	default:
+		fmt.Fprint(b, v)
+	}
+}
@@ -0,0 +1,197 @@
+package goexpr
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input  string
+		wanted string
+	}{
+		{"a+b*c", "a + b * c"},
+		{"(a+b)*c", "(a + b) * c"},
+		{"a-(b-c)", "a - (b - c)"},
+		{"(a-b)-c", "a - b - c"},
+		{"((a))", "a"},
+		{"!(a&&b)", "!(a && b)"},
+		{"!a||b", "!a || b"},
+		{"-(-x)", "-(-x)"},
+		{"!(-x)", "!(-x)"},
+		{"-(!x)", "- !x"},
+		{"!(!x)", "! !x"},
+		{"-(a.b)", "-a.b"},
+		{"-(\"x\")", "-(\"x\")"},
+		{"!(nil)", "!(nil)"},
+		{"-([1])", "-([1])"},
+		{"!(true) && -(1)", "!true && -1"},
+		{"x & 1 == 1", "x & 1 == 1"},
+		{"(x & 1) == 1", "(x & 1) == 1"},
+		{"1 << (2 + 3)", "1 << 2 + 3"},
+		{"(1 << 2) + 3", "(1 << 2) + 3"},
+		{"a ? b : c ? d : e", "a ? b : c ? d : e"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e"},
+		{"a ? (b ? c : d) : e", "a ? b ? c : d : e"},
+		{"a ? (b ? c) : d", "a ? (b ? c) : d"},
+		{"a ? (b ? c)", "a ? b ? c"},
+		{"(a ?? b) ?? c", "a ?? b ?? c"},
+		{"a ?? (b ?? c)", "a ?? (b ?? c)"},
+		{"(a || b) ?? c", "a || b ?? c"},
+		{"a || (b ?? c)", "a || (b ?? c)"},
+		{"a ?? b || c", "a ?? b || c"},
+		{"x   not  in[\"a\",'b',1.50]", "x not in [\"a\", 'b', 1.5]"},
+		{"s =~ `\\d+\"`", "s =~ \"\\\\d+\\\"\""},
+		{"'\\n' == '\\''", "'\\n' == '\\''"},
+		{"2 * 3.0", "2 * 3.0"},
+		{"a.b [ c ].d?.e.f", "a.b[c].d?.e.f"},
+		{"u.Greet( \"a\" ,b ).Len()", "u.Greet(\"a\", b).Len()"},
+		{"max( a,[ ] )", "max(a, [])"},
+		{"nil ?? true", "nil ?? true"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		res, err := Format(test.input)
+		if err != nil {
+			t.Errorf("input %s failed to format: %s", test.input, err)
+			continue
+		}
+		if res != test.wanted {
+			t.Errorf("input %s: formatted %s does not match wanted: %s", test.input, res, test.wanted)
+		}
+	}
+
+	if _, err := Format("a +"); !errors.Is(err, ErrSyntax) {
+		t.Errorf("error %v should be a syntax error", err)
+	}
+}
+
+func TestExprString(t *testing.T) {
+	tests := []struct {
+		input    string
+		wanted   string
+		optimize bool
+	}{
+		{input: "(1 + 2) * x", wanted: "(1 + 2) * x"},
+		{input: "(1 + 2) * x", wanted: "3 * x", optimize: true},
+		{input: "x - (0 - 3)", wanted: "x - -3", optimize: true},
+		{input: "-x * -(-3)", wanted: "-x * -(-3)"},
+		{input: "x * (1 / 2.0)", wanted: "x * 0.5", optimize: true},
+		{input: "x * (2 * 1.5)", wanted: "x * 3.0", optimize: true},
+		{input: "x + 1.0 / 0", wanted: "x + (1.0 / 0)", optimize: true},
+		{input: "x in [\"a\", 'b']", wanted: "x in [\"a\", 'b']", optimize: true},
+		{input: "x ?? (-9223372036854775807 - 1)", wanted: "x ?? (-9223372036854775807 - 1)", optimize: true},
+	}
+
+	for _, test := range tests {
+		opts := []Option{WithoutOptimization()}
+		if test.optimize {
+			opts = nil
+		}
+		expr, err := NewExpr(test.input, opts...)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		if res := expr.String(); res != test.wanted {
+			t.Errorf("input %s: string %s does not match wanted: %s", test.input, res, test.wanted)
+		}
+	}
+}
+
+// the formatted expression is evaluated as the original one, and formatting it again changes nothing
+func TestFormatRoundTrip(t *testing.T) {
+	params := map[string]interface{}{
+		"x":    int64(7),
+		"f":    2.5,
+		"s":    "abc",
+		"ok":   true,
+		"list": []interface{}{10, 20, 30},
+		"user": map[string]interface{}{"name": "Bob", "nickname": nil},
+		"bob":  &testUser{First: "Bob", Last: "Smith"},
+	}
+	inputs := []string{
+		"1 + 2 * 3 - 4 / 5",
+		"(1 + 2) * (3 - 4) / 5",
+		"x - (3 - 1) - (2 - (1 - x))",
+		"x / (2 / 4.0) % 3",
+		"-(x - 1) * -f",
+		"-(-x) + -(-(-f))",
+		"!(-x > 1) && - !ok == false",
+		"!(!ok) && !(x > 1)",
+		`-("x") ?? !(nil)`,
+		`!("s") || -([1]) == -('c')`,
+		"x > 5 && f < 3 || !ok",
+		"x > 5 && (f < 3 || !ok)",
+		"(x & 3) == 3 ? x | 8 : x ^ 1",
+		"1 << (x - 5) >> 1",
+		"x > 5 ? x > 6 ? 1 : 2 : 3",
+		"(x > 5 ? false : true) ? 1 : 2",
+		"x > 5 ? (x > 6 ? 1) : 3",
+		"x < 5 ? 1",
+		"list[1] + list[x - 5]",
+		"user.nickname ?? user.name",
+		"(user.alias ?? x) + 1",
+		"user.alias ?? (missing ?? user.name)",
+		"visitor?.name ?? (x > 1 ? \"guest\" : nil)",
+		"x in [1, x, 3] && s not in []",
+		"(x in [1, 2]) == false",
+		`s =~ "^a" && s !~ "c$"`,
+		"s + '\\t' + \"\\\"q\\\"\"",
+		"[x, [s], nil, 1.0 / 0]",
+		"bob.FullName() + bob.Greet(\"Hi\")",
+		"1.0 - 1 + 0.25",
+		"-9223372036854775807 - 1 + x",
+		"x << (-1)",
+		"x << (0 - 1)",
+		"x >> (-(-1)) | (-x) & (-2)",
+		"(-x ^ (-1)) + -(x & 2)",
+	}
+
+	for _, opts := range [][]Option{nil, {WithoutOptimization()}} {
+		for _, input := range inputs {
+			expr, err := NewExprWithFunctions(input, testFunctions, opts...)
+			if err != nil {
+				t.Errorf("input %s failed to parse: %s", input, err)
+				continue
+			}
+			wanted, wantedErr := expr.Eval(params)
+
+			formatted := expr.String()
+			again, err := NewExprWithFunctions(formatted, testFunctions, opts...)
+			if err != nil {
+				t.Errorf("input %s: formatted %s failed to parse: %s", input, formatted, err)
+				continue
+			}
+			res, err := again.Eval(params)
+			if !reflect.DeepEqual(res, wanted) && !(isNaN(res) && isNaN(wanted)) {
+				t.Errorf("input %s: formatted %s gives '%v' instead of '%v'", input, formatted, res, wanted)
+			}
+			if (err == nil) != (wantedErr == nil) {
+				t.Errorf("input %s: formatted %s gives error %v instead of %v", input, formatted, err, wantedErr)
+			}
+			if s := again.String(); s != formatted {
+				t.Errorf("input %s: formatted %s is formatted again as %s", input, formatted, s)
+			}
+
+			canonical, err := Format(input)
+			if err != nil || (len(opts) > 0 && canonical != formatted) {
+				t.Errorf("input %s: Format gives %s, error %v, wanted %s", input, canonical, err, formatted)
+				continue
+			}
+			if _, err = NewExprWithFunctions(canonical, testFunctions, opts...); err != nil {
+				t.Errorf("input %s: Format gives %s which fails to parse: %s", input, canonical, err)
+			} else if s, err := Format(canonical); err != nil || s != canonical {
+				t.Errorf("input %s: Format gives %s, formatted again as %s, error %v", input, canonical, s, err)
+			}
+		}
+	}
+}
+
+func isNaN(v interface{}) bool {
+	f, ok := v.(float64)
+	return ok && math.IsNaN(f)
+}
@@ -1,4 +1,29 @@
 package goexpr
 
+import (
+	"context"
+	"fmt"
+)
+
 // ExprFunc represents a function that can be called within an expression
-type ExprFunc func(args ...interface{})(interface{}, error)
\ No newline at end of file
+type ExprFunc func(args ...interface{}) (interface{}, error)
+
+// ExprContextFunc represents a function that is given the context of the evaluation,
+// which is the context given to EvalContext, or context.Background()
+type ExprContextFunc func(ctx context.Context, args ...interface{}) (interface{}, error)
+
+func (function ExprFunc) withContext() ExprContextFunc {
+	return func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		return function(args...)
+	}
+}
+
+// FixedArity wraps the function so that it fails when not called with exactly n arguments
+func FixedArity(n int, function ExprFunc) ExprFunc {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) != n {
+			return nil, fmt.Errorf("expected %d arguments, got %d", n, len(args))
+		}
+		return function(args...)
+	}
+}
@@ -21,11 +21,14 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
 			SELECTOR: {},
+			LBRACKET: {},
 		},
 	},
 	CHAR: {
@@ -39,11 +42,17 @@ var lexerRules = map[TokenType]lexerRule{
 			GT:           {},
 			LEQ:          {},
 			GEQ:          {},
+			MATCH:        {},
+			NOT_MATCH:    {},
 			LAND:         {},
 			LOR:          {},
+			COALESCE:     {},
 			TERNARY_IF:   {},
 			TERNARY_ELSE: {},
 			RPAREN:       {},
+			COMMA:        {},
+			IN:           {},
+			NOT_IN:       {},
 		},
 	},
 	STRING: {
@@ -57,12 +66,18 @@ var lexerRules = map[TokenType]lexerRule{
 			GT:           {},
 			LEQ:          {},
 			GEQ:          {},
+			MATCH:        {},
+			NOT_MATCH:    {},
 			ADD:          {},
 			LAND:         {},
 			LOR:          {},
+			COALESCE:     {},
 			TERNARY_IF:   {},
 			TERNARY_ELSE: {},
 			RPAREN:       {},
+			COMMA:        {},
+			IN:           {},
+			NOT_IN:       {},
 		},
 	},
 	NUMBER: {
@@ -76,6 +91,8 @@ var lexerRules = map[TokenType]lexerRule{
 			GT:           {},
 			LEQ:          {},
 			GEQ:          {},
+			MATCH:        {},
+			NOT_MATCH:    {},
 			ADD:          {},
 			SUB:          {},
 			MUL:          {},
@@ -88,9 +105,13 @@ var lexerRules = map[TokenType]lexerRule{
 			SHR:          {},
 			LAND:         {},
 			LOR:          {},
+			COALESCE:     {},
 			TERNARY_IF:   {},
 			TERNARY_ELSE: {},
 			RPAREN:       {},
+			COMMA:        {},
+			IN:           {},
+			NOT_IN:       {},
 		},
 	},
 	BOOL: {
@@ -102,9 +123,31 @@ var lexerRules = map[TokenType]lexerRule{
 			NEQ:          {},
 			LAND:         {},
 			LOR:          {},
+			COALESCE:     {},
 			TERNARY_IF:   {},
 			TERNARY_ELSE: {},
 			RPAREN:       {},
+			COMMA:        {},
+			IN:           {},
+			NOT_IN:       {},
+		},
+	},
+	NIL: {
+		isStartable:  true,
+		isTerminable: true,
+		isNullable:   false,
+		nextAllowable: map[TokenType]struct{}{
+			EQ:           {},
+			NEQ:          {},
+			LAND:         {},
+			LOR:          {},
+			COALESCE:     {},
+			TERNARY_IF:   {},
+			TERNARY_ELSE: {},
+			RPAREN:       {},
+			COMMA:        {},
+			IN:           {},
+			NOT_IN:       {},
 		},
 	},
 	VARIABLE: {
@@ -118,6 +161,8 @@ var lexerRules = map[TokenType]lexerRule{
 			GT:           {},
 			LEQ:          {},
 			GEQ:          {},
+			MATCH:        {},
+			NOT_MATCH:    {},
 			ADD:          {},
 			SUB:          {},
 			MUL:          {},
@@ -130,11 +175,16 @@ var lexerRules = map[TokenType]lexerRule{
 			SHR:          {},
 			LAND:         {},
 			LOR:          {},
+			COALESCE:     {},
 			TERNARY_IF:   {},
 			TERNARY_ELSE: {},
 			RPAREN:       {},
 			LBRACKET:     {},
 			RBRACKET:     {},
+			COMMA:        {},
+			IN:           {},
+			NOT_IN:       {},
+			OPTIONAL:     {},
 		},
 	},
 	ACCESSOR: {
@@ -148,6 +198,8 @@ var lexerRules = map[TokenType]lexerRule{
 			GT:           {},
 			LEQ:          {},
 			GEQ:          {},
+			MATCH:        {},
+			NOT_MATCH:    {},
 			ADD:          {},
 			SUB:          {},
 			MUL:          {},
@@ -160,11 +212,26 @@ var lexerRules = map[TokenType]lexerRule{
 			SHR:          {},
 			LAND:         {},
 			LOR:          {},
+			COALESCE:     {},
 			TERNARY_IF:   {},
 			TERNARY_ELSE: {},
 			RPAREN:       {},
 			LBRACKET:     {},
 			RBRACKET:     {},
+			COMMA:        {},
+			IN:           {},
+			NOT_IN:       {},
+			OPTIONAL:     {},
+		},
+	},
+	OPTIONAL: {
+		isStartable:  false,
+		isTerminable: false,
+		isNullable:   false,
+		nextAllowable: map[TokenType]struct{}{
+			VARIABLE: {},
+			SELECTOR: {},
+			FUNC:     {},
 		},
 	},
 	SELECTOR: {
@@ -178,6 +245,8 @@ var lexerRules = map[TokenType]lexerRule{
 			GT:           {},
 			LEQ:          {},
 			GEQ:          {},
+			MATCH:        {},
+			NOT_MATCH:    {},
 			ADD:          {},
 			SUB:          {},
 			MUL:          {},
@@ -190,11 +259,16 @@ var lexerRules = map[TokenType]lexerRule{
 			SHR:          {},
 			LAND:         {},
 			LOR:          {},
+			COALESCE:     {},
 			TERNARY_IF:   {},
 			TERNARY_ELSE: {},
 			RPAREN:       {},
 			LBRACKET:     {},
 			RBRACKET:     {},
+			COMMA:        {},
+			IN:           {},
+			NOT_IN:       {},
+			OPTIONAL:     {},
 		},
 	},
 	LPAREN: {
@@ -206,12 +280,15 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
 			RPAREN:   {},
 			SELECTOR: {},
+			LBRACKET: {},
 		},
 	},
 	RPAREN: {
@@ -223,15 +300,20 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
-			NEG:      {},
 			SELECTOR: {},
 			ACCESSOR: {},
 			LPAREN:   {},
 			RPAREN:   {},
 			LBRACKET: {},
 			RBRACKET: {},
+			COMMA:    {},
+			IN:       {},
+			NOT_IN:   {},
+			OPTIONAL: {},
 		},
 	},
 	LBRACKET: {
@@ -242,8 +324,15 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			LPAREN:   {},
 			SELECTOR: {},
+			CHAR:     {},
+			BOOL:     {},
+			NIL:      {},
+			NOT:      {},
+			NEG:      {},
+			RBRACKET: {},
 		},
 	},
 	RBRACKET: {
@@ -257,6 +346,8 @@ var lexerRules = map[TokenType]lexerRule{
 			GT:           {},
 			LEQ:          {},
 			GEQ:          {},
+			MATCH:        {},
+			NOT_MATCH:    {},
 			ADD:          {},
 			SUB:          {},
 			MUL:          {},
@@ -269,11 +360,16 @@ var lexerRules = map[TokenType]lexerRule{
 			SHR:          {},
 			LAND:         {},
 			LOR:          {},
+			COALESCE:     {},
 			TERNARY_IF:   {},
 			TERNARY_ELSE: {},
 			RPAREN:       {},
 			SELECTOR:     {},
 			ACCESSOR:     {},
+			COMMA:        {},
+			IN:           {},
+			NOT_IN:       {},
+			OPTIONAL:     {},
 		},
 	},
 	ADD: {
@@ -286,6 +382,7 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			SELECTOR: {},
 		},
 	},
@@ -298,6 +395,7 @@ var lexerRules = map[TokenType]lexerRule{
 			CHAR:     {},
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			SELECTOR: {},
 		},
 	},
@@ -309,6 +407,7 @@ var lexerRules = map[TokenType]lexerRule{
 			NEG:      {},
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			SELECTOR: {},
 		},
 	},
@@ -320,6 +419,7 @@ var lexerRules = map[TokenType]lexerRule{
 			NEG:      {},
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			SELECTOR: {},
 		},
 	},
@@ -331,6 +431,7 @@ var lexerRules = map[TokenType]lexerRule{
 			NEG:      {},
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			SELECTOR: {},
 		},
 	},
@@ -341,6 +442,7 @@ var lexerRules = map[TokenType]lexerRule{
 		nextAllowable: map[TokenType]struct{}{
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			SELECTOR: {},
 		},
 	},
@@ -351,6 +453,7 @@ var lexerRules = map[TokenType]lexerRule{
 		nextAllowable: map[TokenType]struct{}{
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			SELECTOR: {},
 		},
 	},
@@ -361,6 +464,7 @@ var lexerRules = map[TokenType]lexerRule{
 		nextAllowable: map[TokenType]struct{}{
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			SELECTOR: {},
 		},
 	},
@@ -371,6 +475,7 @@ var lexerRules = map[TokenType]lexerRule{
 		nextAllowable: map[TokenType]struct{}{
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			SELECTOR: {},
 		},
 	},
@@ -381,6 +486,7 @@ var lexerRules = map[TokenType]lexerRule{
 		nextAllowable: map[TokenType]struct{}{
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			SELECTOR: {},
 		},
 	},
@@ -393,10 +499,13 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
+			LBRACKET: {},
 		},
 	},
 	NEQ: {
@@ -408,10 +517,49 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
+			LBRACKET: {},
+		},
+	},
+	MATCH: {
+		isStartable:  false,
+		isTerminable: false,
+		isNullable:   false,
+		nextAllowable: map[TokenType]struct{}{
+			CHAR:     {},
+			STRING:   {},
+			NUMBER:   {},
+			BOOL:     {},
+			NIL:      {},
+			VARIABLE: {},
+			FUNC:     {},
+			NOT:      {},
+			NEG:      {},
+			LPAREN:   {},
+			LBRACKET: {},
+		},
+	},
+	NOT_MATCH: {
+		isStartable:  false,
+		isTerminable: false,
+		isNullable:   false,
+		nextAllowable: map[TokenType]struct{}{
+			CHAR:     {},
+			STRING:   {},
+			NUMBER:   {},
+			BOOL:     {},
+			NIL:      {},
+			VARIABLE: {},
+			FUNC:     {},
+			NOT:      {},
+			NEG:      {},
+			LPAREN:   {},
+			LBRACKET: {},
 		},
 	},
 	LT: {
@@ -423,7 +571,9 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
@@ -438,7 +588,9 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
@@ -453,7 +605,9 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
@@ -468,7 +622,9 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
@@ -483,7 +639,9 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
@@ -498,12 +656,69 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
 		},
 	},
+	COALESCE: {
+		isStartable:  false,
+		isTerminable: false,
+		isNullable:   false,
+		nextAllowable: map[TokenType]struct{}{
+			CHAR:     {},
+			STRING:   {},
+			NUMBER:   {},
+			BOOL:     {},
+			NIL:      {},
+			VARIABLE: {},
+			FUNC:     {},
+			NOT:      {},
+			NEG:      {},
+			LPAREN:   {},
+			SELECTOR: {},
+			LBRACKET: {},
+		},
+	},
+	IN: {
+		isStartable:  false,
+		isTerminable: false,
+		isNullable:   false,
+		nextAllowable: map[TokenType]struct{}{
+			CHAR:     {},
+			STRING:   {},
+			NUMBER:   {},
+			BOOL:     {},
+			NIL:      {},
+			VARIABLE: {},
+			FUNC:     {},
+			NEG:      {},
+			LPAREN:   {},
+			LBRACKET: {},
+			SELECTOR: {},
+		},
+	},
+	NOT_IN: {
+		isStartable:  false,
+		isTerminable: false,
+		isNullable:   false,
+		nextAllowable: map[TokenType]struct{}{
+			CHAR:     {},
+			STRING:   {},
+			NUMBER:   {},
+			BOOL:     {},
+			NIL:      {},
+			VARIABLE: {},
+			FUNC:     {},
+			NEG:      {},
+			LPAREN:   {},
+			LBRACKET: {},
+			SELECTOR: {},
+		},
+	},
 	TERNARY_IF: {
 		isStartable:  false,
 		isTerminable: false,
@@ -513,10 +728,13 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
+			LBRACKET: {},
 		},
 	},
 	TERNARY_ELSE: {
@@ -528,10 +746,13 @@ var lexerRules = map[TokenType]lexerRule{
 			STRING:   {},
 			NUMBER:   {},
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			NOT:      {},
 			NEG:      {},
 			LPAREN:   {},
+			LBRACKET: {},
 		},
 	},
 	NOT: {
@@ -540,7 +761,9 @@ var lexerRules = map[TokenType]lexerRule{
 		isNullable:   false,
 		nextAllowable: map[TokenType]struct{}{
 			BOOL:     {},
+			NIL:      {},
 			VARIABLE: {},
+			FUNC:     {},
 			LPAREN:   {},
 			SELECTOR: {},
 		},
@@ -552,10 +775,38 @@ var lexerRules = map[TokenType]lexerRule{
 		nextAllowable: map[TokenType]struct{}{
 			NUMBER:   {},
 			VARIABLE: {},
+			FUNC:     {},
 			LPAREN:   {},
 			SELECTOR: {},
 		},
 	},
+	FUNC: {
+		isStartable:  true,
+		isTerminable: false,
+		isNullable:   false,
+		nextAllowable: map[TokenType]struct{}{
+			LPAREN: {},
+		},
+	},
+	COMMA: {
+		isStartable:  false,
+		isTerminable: false,
+		isNullable:   false,
+		nextAllowable: map[TokenType]struct{}{
+			CHAR:     {},
+			STRING:   {},
+			NUMBER:   {},
+			BOOL:     {},
+			NIL:      {},
+			VARIABLE: {},
+			FUNC:     {},
+			NOT:      {},
+			NEG:      {},
+			LPAREN:   {},
+			SELECTOR: {},
+			LBRACKET: {},
+		},
+	},
 }
 
 func (ls *lexerRule) hasNextAllowable(tokenType TokenType) bool {
@@ -574,23 +825,27 @@ func getLexerRule(tokenType TokenType) (lexerRule, error) {
 }
 
 func checkLexerBalance(tokens []LexerToken) error {
-	var parens, brackets int
+	var opened []LexerToken
 	stream := newLexerStream(tokens)
 	for stream.notEOF() {
 		token := stream.flowForward()
 		switch token.Type {
-		case LPAREN:
-			parens++
-		case LBRACKET:
-			brackets++
-		case RPAREN:
-			parens--
-		case RBRACKET:
-			brackets--
+		case LPAREN, LBRACKET:
+			opened = append(opened, token)
+		case RPAREN, RBRACKET:
+			if len(opened) == 0 || !isMatchingPair(opened[len(opened)-1].Type, token.Type) {
+				return newSyntaxError(token.Pos, token.End, "unbalanced parenthesis or bracket")
+			}
+			opened = opened[:len(opened)-1]
 		}
 	}
-	if parens != 0 || brackets != 0 {
-		return fmt.Errorf("unbalanced parenthesis or bracket")
+	if len(opened) != 0 {
+		token := opened[len(opened)-1]
+		return newSyntaxError(token.Pos, token.End, "unbalanced parenthesis or bracket")
 	}
 	return nil
 }
+
+func isMatchingPair(open, close TokenType) bool {
+	return (open == LPAREN && close == RPAREN) || (open == LBRACKET && close == RBRACKET)
+}
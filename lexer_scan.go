@@ -2,15 +2,18 @@ package goexpr
 
 import (
 	"bytes"
-	"fmt"
+	"errors"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type LexerToken struct {
 	Type  TokenType
 	Value interface{}
+	Pos   Position // position of the first character
+	End   Position // position following the last character
 }
 
 func lexerScan(expr string) (tokens []LexerToken, err error) {
@@ -34,7 +37,7 @@ func lexerScan(expr string) (tokens []LexerToken, err error) {
 
 		tokenRule, err = getLexerRule(token.Type)
 		if err != nil {
-			return tokens, err
+			return tokens, wrapError(err, token.Pos, token.End)
 		}
 
 		tokens = append(tokens, token)
@@ -49,6 +52,7 @@ func lexerScan(expr string) (tokens []LexerToken, err error) {
 func tokenScan(stream *runeStream, rule lexerRule) (LexerToken, bool, error) {
 	var (
 		char      rune
+		start     Position
 		tokenType TokenType
 		tokenStr  string
 		tokenVal  interface{}
@@ -56,6 +60,7 @@ func tokenScan(stream *runeStream, rule lexerRule) (LexerToken, bool, error) {
 		err       error
 	)
 	for stream.notEOF() {
+		start = stream.position()
 		char = stream.flowForward()
 		if unicode.IsSpace(char) {
 			continue
@@ -64,9 +69,20 @@ func tokenScan(stream *runeStream, rule lexerRule) (LexerToken, bool, error) {
 		tokenType = ILLEGAL
 		if unicode.IsDigit(char) {
 			tokenStr = readWithCond(stream, isNumeric)
-			tokenVal, err = strconv.ParseFloat(tokenStr, 64)
-			if err != nil {
-				return LexerToken{}, false, fmt.Errorf("unable to parse numeric value '%v' to float64", tokenStr)
+			if strings.Contains(tokenStr, ".") {
+				tokenVal, err = strconv.ParseFloat(tokenStr, 64)
+				if err != nil {
+					return LexerToken{}, false, newSyntaxError(start, stream.tokenEnd(), "unable to parse numeric value '%v' to float64", tokenStr)
+				}
+			} else {
+				tokenVal, err = strconv.ParseInt(tokenStr, 10, 64)
+				if errors.Is(err, strconv.ErrRange) {
+					// an integer beyond the int64 range is scanned as a float64
+					tokenVal, err = strconv.ParseFloat(tokenStr, 64)
+				}
+				if err != nil {
+					return LexerToken{}, false, newSyntaxError(start, stream.tokenEnd(), "unable to parse numeric value '%v' to int64", tokenStr)
+				}
 			}
 			tokenType = NUMBER
 			break
@@ -84,15 +100,29 @@ func tokenScan(stream *runeStream, rule lexerRule) (LexerToken, bool, error) {
 			} else if strings.ToUpper(tokenStr) == "FALSE" {
 				tokenType = BOOL
 				tokenVal = false
+			} else if tokenStr == "nil" {
+				tokenType = NIL
+				tokenVal = nil
+				break
+			} else if tokenStr == "in" {
+				tokenType = IN
+				break
+			} else if tokenStr == "not" && stream.skipWord("in") {
+				tokenType = NOT_IN
+				tokenVal = "not in"
+				break
 			}
 
 			if strings.Contains(tokenStr, ".") {
 				//can not be the last one
 				if tokenStr[len(tokenStr)-1] == '.' {
-					return LexerToken{}, false, fmt.Errorf("selector at tail of token %v", tokenStr)
+					return LexerToken{}, false, newSyntaxError(start, stream.tokenEnd(), "selector at tail of token %v", tokenStr)
 				}
 				tokenType = SELECTOR
 				tokenVal = strings.Split(tokenStr, ".")
+			} else if tokenType == VARIABLE && stream.peekNonSpace() == '(' {
+				// name(arg1, arg2, ...)
+				tokenType = FUNC
 			}
 			break
 		}
@@ -100,7 +130,7 @@ func tokenScan(stream *runeStream, rule lexerRule) (LexerToken, bool, error) {
 		if isDot(char) {
 			tokenStr = readWithCond(stream, isVariable)
 			if tokenStr[len(tokenStr)-1] == '.' {
-				return LexerToken{}, false, fmt.Errorf("accessor at tail of token %v", tokenStr)
+				return LexerToken{}, false, newSyntaxError(start, stream.tokenEnd(), "accessor at tail of token %v", tokenStr)
 			}
 			tokenType = ACCESSOR
 			tokenVal = strings.Split(tokenStr, ".")[1:]
@@ -108,24 +138,44 @@ func tokenScan(stream *runeStream, rule lexerRule) (LexerToken, bool, error) {
 		}
 
 		if isDoubleQuote(char) {
-			tokenStr, completed = readWithFlagAndCond(stream, false, true, isNotDoubleQuote)
-			if !completed {
-				return LexerToken{}, false, fmt.Errorf("literal string unclosed")
+			tokenStr, _, err = readQuoted(stream, char)
+			if err != nil {
+				return LexerToken{}, false, err
 			}
+			if !stream.notEOF() || stream.flowForward() != char { //jump over "
+				return LexerToken{}, false, newSyntaxError(start, stream.tokenEnd(), "literal string unclosed")
+			}
+			tokenVal = tokenStr
+			tokenType = STRING
+			break
+		}
 
-			stream.flowBackward(-1) //jump over "
+		if isBackQuote(char) {
+			tokenStr, completed = readRaw(stream)
+			if !completed {
+				return LexerToken{}, false, newSyntaxError(start, stream.tokenEnd(), "raw string unclosed")
+			}
 			tokenVal = tokenStr
 			tokenType = STRING
 			break
 		}
 
 		if isSingleQuote(char) {
-			tokenVal = stream.flowForward()
-			tokenType = CHAR
+			var runes []rune
+			tokenStr, runes, err = readQuoted(stream, char)
+			if err != nil {
+				return LexerToken{}, false, err
+			}
+			if !stream.notEOF() {
+				return LexerToken{}, false, newSyntaxError(start, stream.tokenEnd(), "literal char unclosed")
+			}
 			//jump over '
-			if stream.flowForward() != '\'' {
-				return LexerToken{}, false, fmt.Errorf("more than 1 charactor for char type")
+			stream.flowForward()
+			if len(runes) != 1 {
+				return LexerToken{}, false, newSyntaxError(start, stream.tokenEnd(), "more than 1 charactor for char type")
 			}
+			tokenVal = runes[0]
+			tokenType = CHAR
 			break
 		}
 
@@ -152,6 +202,12 @@ func tokenScan(stream *runeStream, rule lexerRule) (LexerToken, bool, error) {
 			break
 		}
 
+		if char == ',' {
+			tokenVal = char
+			tokenType = COMMA
+			break
+		}
+
 		//then it must be an operator
 		tokenStr = readWithCond(stream, isNotAlphanumeric)
 		tokenVal = tokenStr
@@ -168,11 +224,13 @@ func tokenScan(stream *runeStream, rule lexerRule) (LexerToken, bool, error) {
 			tokenType = tok
 			break
 		}
-		return LexerToken{}, false, fmt.Errorf("invalid token %v", tokenStr)
+		return LexerToken{}, false, newSyntaxError(start, stream.tokenEnd(), "invalid token %v", tokenStr)
 	}
 	res := LexerToken{
 		Type:  tokenType,
 		Value: tokenVal,
+		Pos:   start,
+		End:   stream.tokenEnd(),
 	}
 
 	return res, tokenType != ILLEGAL, nil
@@ -192,8 +250,8 @@ func isDoubleQuote(char rune) bool {
 	return char == '"'
 }
 
-func isNotDoubleQuote(char rune) bool {
-	return !isDoubleQuote(char)
+func isBackQuote(char rune) bool {
+	return char == '`'
 }
 
 func isSingleQuote(char rune) bool {
@@ -206,7 +264,8 @@ func isDot(char rune) bool {
 
 func isNotAlphanumeric(char rune) bool {
 	return !(unicode.IsDigit(char) || unicode.IsLetter(char) ||
-		char == '(' || char == ')' || char == '[' || char == ']')
+		char == '(' || char == ')' || char == '[' || char == ']' || char == ',' ||
+		isDoubleQuote(char) || isSingleQuote(char) || isBackQuote(char))
 }
 
 func readWithCond(stream *runeStream, cond func(rune) bool) string {
@@ -244,3 +303,84 @@ func readWithFlagAndCond(stream *runeStream, breakWhenSpace, includeWhenSpace bo
 	res = buffer.String()
 	return
 }
+
+// readQuoted reads a literal string or char up to the closing quote, which is left in the stream,
+// escape sequences are decoded as in Go: \n, \t, \", \x41, \u00e9, ...
+// the runes are the characters read, one per escape sequence, so that '\xff' is the char 255
+// while "\xff" is the string of the single byte 0xff
+func readQuoted(stream *runeStream, quote rune) (string, []rune, error) {
+	var buffer bytes.Buffer
+	var runes []rune
+	for stream.notEOF() {
+		start := stream.position()
+		char := stream.flowForward()
+		if char == quote {
+			stream.flowBackward(1)
+			break
+		}
+		if char != '\\' {
+			buffer.WriteRune(char)
+			runes = append(runes, char)
+			continue
+		}
+
+		sequence := readEscape(stream)
+		value, multibyte, tail, err := strconv.UnquoteChar(sequence, byte(quote))
+		if err != nil || tail != "" {
+			return "", nil, newSyntaxError(start, stream.position(), "invalid escape sequence %s", sequence)
+		}
+		runes = append(runes, value)
+		if multibyte || value < utf8.RuneSelf {
+			buffer.WriteRune(value)
+		} else {
+			// \x and octal escapes are bytes
+			buffer.WriteByte(byte(value))
+		}
+	}
+	return buffer.String(), runes, nil
+}
+
+// readEscape reads an escape sequence whose backslash was just read,
+// the sequence is returned with its backslash and validated by the caller
+func readEscape(stream *runeStream) string {
+	length := 1
+	if stream.notEOF() {
+		switch stream.runes[stream.pos] {
+		case 'x':
+			length = 3
+		case 'u':
+			length = 5
+		case 'U':
+			length = 9
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			length = 3
+		}
+	}
+
+	sequence := []rune{'\\'}
+	for i := 0; i < length && stream.notEOF(); i++ {
+		char := stream.flowForward()
+		if i > 0 && (isDoubleQuote(char) || isSingleQuote(char)) {
+			stream.flowBackward(1)
+			break
+		}
+		sequence = append(sequence, char)
+	}
+	return string(sequence)
+}
+
+// readRaw reads a raw string up to the closing back quote, without decoding escape sequences,
+// carriage returns are discarded as in Go
+func readRaw(stream *runeStream) (string, bool) {
+	var buffer bytes.Buffer
+	for stream.notEOF() {
+		char := stream.flowForward()
+		if isBackQuote(char) {
+			return buffer.String(), true
+		}
+		if char != '\r' {
+			buffer.WriteRune(char)
+		}
+	}
+	return buffer.String(), false
+}
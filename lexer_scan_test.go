@@ -18,7 +18,7 @@ func TestNumericParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 0.0,
+					Value: int64(0),
 				},
 			},
 		},
@@ -28,7 +28,7 @@ func TestNumericParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 35.0,
+					Value: int64(35),
 				},
 			},
 		},
@@ -38,7 +38,17 @@ func TestNumericParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 3276842433.0,
+					Value: int64(3276842433),
+				},
+			},
+		},
+		{
+			Name:  "Integer beyond int64",
+			Input: "9223372036854775808",
+			Wanted: []LexerToken{
+				{
+					Type:  NUMBER,
+					Value: 9223372036854775808.0,
 				},
 			},
 		},
@@ -92,6 +102,167 @@ func TestStringParse(t *testing.T) {
 	runParseTokenTest(parseTokenTests, t)
 }
 
+func TestEscapeParse(t *testing.T) {
+	parseTokenTests := []ParseTokenTest{
+		{
+			Name:  "Escaped quote",
+			Input: `"say \"hi\""`,
+			Wanted: []LexerToken{
+				{
+					Type:  STRING,
+					Value: `say "hi"`,
+				},
+			},
+		},
+		{
+			Name:  "Escaped control characters",
+			Input: `"a\tb\nc\\"`,
+			Wanted: []LexerToken{
+				{
+					Type:  STRING,
+					Value: "a\tb\nc\\",
+				},
+			},
+		},
+		{
+			Name:  "Unicode escapes",
+			Input: `"caf\u00e9 \U0001F600"`,
+			Wanted: []LexerToken{
+				{
+					Type:  STRING,
+					Value: "café \U0001F600",
+				},
+			},
+		},
+		{
+			Name:  "Byte escapes",
+			Input: `"\x41\102"`,
+			Wanted: []LexerToken{
+				{
+					Type:  STRING,
+					Value: "AB",
+				},
+			},
+		},
+		{
+			Name:  "Raw string",
+			Input: "`C:\\dir\\\"x\"`",
+			Wanted: []LexerToken{
+				{
+					Type:  STRING,
+					Value: `C:\dir\"x"`,
+				},
+			},
+		},
+		{
+			Name:  "Raw string with operator",
+			Input: "name =~ `^\\w+$`",
+			Wanted: []LexerToken{
+				{
+					Type:  VARIABLE,
+					Value: "name",
+				},
+				{
+					Type:  MATCH,
+					Value: "=~",
+				},
+				{
+					Type:  STRING,
+					Value: `^\w+$`,
+				},
+			},
+		},
+		{
+			Name:  "Escaped single quote char",
+			Input: `'\''`,
+			Wanted: []LexerToken{
+				{
+					Type:  CHAR,
+					Value: '\'',
+				},
+			},
+		},
+		{
+			Name:  "Escaped newline char",
+			Input: `'\n'`,
+			Wanted: []LexerToken{
+				{
+					Type:  CHAR,
+					Value: '\n',
+				},
+			},
+		},
+		{
+			Name:  "Unicode escape char",
+			Input: `'\u00e9'`,
+			Wanted: []LexerToken{
+				{
+					Type:  CHAR,
+					Value: 'é',
+				},
+			},
+		},
+		{
+			Name:  "Hex escape char",
+			Input: `'\xff'`,
+			Wanted: []LexerToken{
+				{
+					Type:  CHAR,
+					Value: rune(255),
+				},
+			},
+		},
+		{
+			Name:  "Octal escape char",
+			Input: `'\377'`,
+			Wanted: []LexerToken{
+				{
+					Type:  CHAR,
+					Value: rune(255),
+				},
+			},
+		},
+		{
+			Name:  "Hex escape string",
+			Input: `"\xff"`,
+			Wanted: []LexerToken{
+				{
+					Type:  STRING,
+					Value: "\xff",
+				},
+			},
+		},
+	}
+	runParseTokenTest(parseTokenTests, t)
+}
+
+func TestEscapeErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		column int
+	}{
+		{input: `"\q"`, column: 2},
+		{input: `"ab\x4"`, column: 4},
+		{input: `"\u00e"`, column: 2},
+		{input: `"\'"`, column: 2},
+		{input: `'\"'`, column: 2},
+		{input: `'ab'`, column: 1},
+		{input: `"abc`, column: 1},
+		{input: "`abc", column: 1},
+	}
+	for _, test := range tests {
+		_, err := lexerScan(test.input)
+		exprErr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("input %s: error %v is not an *Error", test.input, err)
+			continue
+		}
+		if exprErr.Pos.Column != test.column {
+			t.Errorf("input %s: error %v should start at column %d", test.input, err, test.column)
+		}
+	}
+}
+
 func TestBooleanParse(t *testing.T) {
 	parseTokenTests := []ParseTokenTest{
 		{
@@ -166,7 +337,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  ADD,
@@ -174,7 +345,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -184,7 +355,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  ADD,
@@ -192,7 +363,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -202,7 +373,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  ADD,
@@ -210,7 +381,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -220,7 +391,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  SUB,
@@ -228,7 +399,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -238,7 +409,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  SUB,
@@ -246,7 +417,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -256,7 +427,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  SUB,
@@ -264,7 +435,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -274,7 +445,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  MUL,
@@ -282,7 +453,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -292,7 +463,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  MUL,
@@ -300,7 +471,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -310,7 +481,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  MUL,
@@ -318,7 +489,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -328,7 +499,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  QUO,
@@ -336,7 +507,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -346,7 +517,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  QUO,
@@ -354,7 +525,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -364,7 +535,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  QUO,
@@ -372,7 +543,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -382,7 +553,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  REM,
@@ -390,7 +561,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -400,7 +571,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  REM,
@@ -408,7 +579,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -418,7 +589,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  REM,
@@ -426,7 +597,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -436,7 +607,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  AND,
@@ -444,7 +615,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -454,7 +625,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  OR,
@@ -462,7 +633,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -472,7 +643,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  XOR,
@@ -480,7 +651,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -490,7 +661,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  SHL,
@@ -498,7 +669,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -508,7 +679,7 @@ func TestModifierParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  SHR,
@@ -516,7 +687,7 @@ func TestModifierParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -532,7 +703,7 @@ func TestComparatorParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  EQ,
@@ -540,7 +711,7 @@ func TestComparatorParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -550,7 +721,7 @@ func TestComparatorParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  EQ,
@@ -558,7 +729,7 @@ func TestComparatorParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -568,7 +739,7 @@ func TestComparatorParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  EQ,
@@ -576,7 +747,7 @@ func TestComparatorParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -586,7 +757,7 @@ func TestComparatorParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  NEQ,
@@ -594,7 +765,7 @@ func TestComparatorParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -604,7 +775,7 @@ func TestComparatorParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  GT,
@@ -612,7 +783,7 @@ func TestComparatorParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -622,7 +793,7 @@ func TestComparatorParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  LT,
@@ -630,7 +801,7 @@ func TestComparatorParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -640,7 +811,7 @@ func TestComparatorParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  LEQ,
@@ -648,7 +819,7 @@ func TestComparatorParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -658,7 +829,7 @@ func TestComparatorParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  GEQ,
@@ -666,7 +837,7 @@ func TestComparatorParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 			},
 		},
@@ -794,7 +965,7 @@ func TestPrefixParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 			},
 		},
@@ -860,7 +1031,7 @@ func TestTernaryParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 			},
 		},
@@ -906,7 +1077,7 @@ func TestTernaryParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  EQ,
@@ -914,7 +1085,7 @@ func TestTernaryParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 				{
 					Type:  TERNARY_IF,
@@ -932,7 +1103,7 @@ func TestTernaryParse(t *testing.T) {
 			Wanted: []LexerToken{
 				{
 					Type:  NUMBER,
-					Value: 1.0,
+					Value: int64(1),
 				},
 				{
 					Type:  EQ,
@@ -940,7 +1111,7 @@ func TestTernaryParse(t *testing.T) {
 				},
 				{
 					Type:  NUMBER,
-					Value: 2.0,
+					Value: int64(2),
 				},
 				{
 					Type:  TERNARY_IF,
@@ -964,6 +1135,64 @@ func TestTernaryParse(t *testing.T) {
 	runParseTokenTest(parseTokenTests, t)
 }
 
+func TestFuncParse(t *testing.T) {
+	parseTokenTests := []ParseTokenTest{
+		{
+			Name:  "Function without argument",
+			Input: "now()",
+			Wanted: []LexerToken{
+				{
+					Type:  FUNC,
+					Value: "now",
+				},
+				{
+					Type:  LPAREN,
+					Value: '(',
+				},
+				{
+					Type:  RPAREN,
+					Value: ')',
+				},
+			},
+		},
+		{
+			Name:  "Function with arguments",
+			Input: "max (a,-1)",
+			Wanted: []LexerToken{
+				{
+					Type:  FUNC,
+					Value: "max",
+				},
+				{
+					Type:  LPAREN,
+					Value: '(',
+				},
+				{
+					Type:  VARIABLE,
+					Value: "a",
+				},
+				{
+					Type:  COMMA,
+					Value: ',',
+				},
+				{
+					Type:  NEG,
+					Value: "-",
+				},
+				{
+					Type:  NUMBER,
+					Value: int64(1),
+				},
+				{
+					Type:  RPAREN,
+					Value: ')',
+				},
+			},
+		},
+	}
+	runParseTokenTest(parseTokenTests, t)
+}
+
 func runParseTokenTest(parseTokenTests []ParseTokenTest, t *testing.T) {
 	var (
 		wantedTokenLength, actualTokenLength int
@@ -1006,3 +1235,201 @@ func runParseTokenTest(parseTokenTests []ParseTokenTest, t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "a.b >= 1 &&\n  name == \"é\""
+	wanted := [][2]Position{
+		{{Offset: 0, Line: 1, Column: 1}, {Offset: 3, Line: 1, Column: 4}},
+		{{Offset: 4, Line: 1, Column: 5}, {Offset: 6, Line: 1, Column: 7}},
+		{{Offset: 7, Line: 1, Column: 8}, {Offset: 8, Line: 1, Column: 9}},
+		{{Offset: 9, Line: 1, Column: 10}, {Offset: 11, Line: 1, Column: 12}},
+		{{Offset: 14, Line: 2, Column: 3}, {Offset: 18, Line: 2, Column: 7}},
+		{{Offset: 19, Line: 2, Column: 8}, {Offset: 21, Line: 2, Column: 10}},
+		{{Offset: 22, Line: 2, Column: 11}, {Offset: 26, Line: 2, Column: 14}},
+	}
+
+	tokens, err := lexerScan(input)
+	if err != nil {
+		t.Fatalf("Expression: %q Error: %s", input, err)
+	}
+	if len(tokens) != len(wanted) {
+		t.Fatalf("Wanted: %d Actually: %d Error: %s", len(wanted), len(tokens), "length not match")
+	}
+	for idx, token := range tokens {
+		if token.Pos != wanted[idx][0] || token.End != wanted[idx][1] {
+			t.Errorf("Token %v: span %+v-%+v does not match wanted: %+v-%+v", token.Value, token.Pos, token.End, wanted[idx][0], wanted[idx][1])
+		}
+	}
+}
+
+func TestMembershipParse(t *testing.T) {
+	parseTokenTests := []ParseTokenTest{
+		{
+			Name:  "In",
+			Input: "a in [1, -2]",
+			Wanted: []LexerToken{
+				{
+					Type:  VARIABLE,
+					Value: "a",
+				},
+				{
+					Type:  IN,
+					Value: "in",
+				},
+				{
+					Type:  LBRACKET,
+					Value: '[',
+				},
+				{
+					Type:  NUMBER,
+					Value: int64(1),
+				},
+				{
+					Type:  COMMA,
+					Value: ',',
+				},
+				{
+					Type:  NEG,
+					Value: "-",
+				},
+				{
+					Type:  NUMBER,
+					Value: int64(2),
+				},
+				{
+					Type:  RBRACKET,
+					Value: ']',
+				},
+			},
+		},
+		{
+			Name:  "Not In",
+			Input: "a not  in b",
+			Wanted: []LexerToken{
+				{
+					Type:  VARIABLE,
+					Value: "a",
+				},
+				{
+					Type:  NOT_IN,
+					Value: "not in",
+				},
+				{
+					Type:  VARIABLE,
+					Value: "b",
+				},
+			},
+		},
+		{
+			Name:  "Variables Named Like Keywords",
+			Input: "not + inner",
+			Wanted: []LexerToken{
+				{
+					Type:  VARIABLE,
+					Value: "not",
+				},
+				{
+					Type:  ADD,
+					Value: "+",
+				},
+				{
+					Type:  VARIABLE,
+					Value: "inner",
+				},
+			},
+		},
+	}
+	runParseTokenTest(parseTokenTests, t)
+}
+
+func TestMatchParse(t *testing.T) {
+	parseTokenTests := []ParseTokenTest{
+		{
+			Name:  "Match",
+			Input: `a =~ "^x"`,
+			Wanted: []LexerToken{
+				{
+					Type:  VARIABLE,
+					Value: "a",
+				},
+				{
+					Type:  MATCH,
+					Value: "=~",
+				},
+				{
+					Type:  STRING,
+					Value: "^x",
+				},
+			},
+		},
+		{
+			Name:  "Not Match Without Spaces",
+			Input: `a!~"^x"`,
+			Wanted: []LexerToken{
+				{
+					Type:  VARIABLE,
+					Value: "a",
+				},
+				{
+					Type:  NOT_MATCH,
+					Value: "!~",
+				},
+				{
+					Type:  STRING,
+					Value: "^x",
+				},
+			},
+		},
+	}
+	runParseTokenTest(parseTokenTests, t)
+}
+
+func TestNilParse(t *testing.T) {
+	parseTokenTests := []ParseTokenTest{
+		{
+			Name:  "Nil",
+			Input: "a == nil",
+			Wanted: []LexerToken{
+				{
+					Type:  VARIABLE,
+					Value: "a",
+				},
+				{
+					Type:  EQ,
+					Value: "==",
+				},
+				{
+					Type:  NIL,
+					Value: nil,
+				},
+			},
+		},
+		{
+			Name:  "Optional Chaining And Coalesce",
+			Input: "a?.b ?? d",
+			Wanted: []LexerToken{
+				{
+					Type:  VARIABLE,
+					Value: "a",
+				},
+				{
+					Type:  OPTIONAL,
+					Value: "?.",
+				},
+				{
+					Type:  VARIABLE,
+					Value: "b",
+				},
+				{
+					Type:  COALESCE,
+					Value: "??",
+				},
+				{
+					Type:  VARIABLE,
+					Value: "d",
+				},
+			},
+		},
+	}
+	runParseTokenTest(parseTokenTests, t)
+}
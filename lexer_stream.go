@@ -1,9 +1,12 @@
 package goexpr
 
 type lexerStream struct {
-	tokens []LexerToken
-	pos    int
-	len    int
+	tokens    []LexerToken
+	pos       int
+	len       int
+	functions map[string]ExprContextFunc
+	depth     int // depth of the recursive calls of the parser
+	maxDepth  int
 }
 
 func newLexerStream(tokens []LexerToken) *lexerStream {
@@ -20,21 +23,54 @@ func (rs *lexerStream) flowForward() LexerToken {
 	return token
 }
 
+func (rs *lexerStream) peek() LexerToken {
+	return rs.tokens[rs.pos]
+}
+
+// prevEnd returns the end position of the last token read
+func (rs *lexerStream) prevEnd() Position {
+	if rs.pos == 0 {
+		return Position{Line: 1, Column: 1}
+	}
+	return rs.tokens[rs.pos-1].End
+}
+
+// eofError reports the input ended while more tokens are expected
+func (rs *lexerStream) eofError(format string, args ...interface{}) *Error {
+	end := Position{Line: 1, Column: 1}
+	if rs.len > 0 {
+		end = rs.tokens[rs.len-1].End
+	}
+	return newSyntaxError(end, end, format, args...)
+}
+
 func (rs *lexerStream) flowBackward() {
 	rs.pos -= 1
 }
 
+// nextIs reports whether the next token is of the given type, without moving forward
+func (rs *lexerStream) nextIs(tokenType TokenType) bool {
+	return rs.notEOF() && rs.tokens[rs.pos].Type == tokenType
+}
+
 func (rs *lexerStream) notEOF() bool {
 	return rs.pos < rs.len
 }
 
-func (rs *lexerStream) getLowestPriority() opPriority {
-	p := priorityLITERAL
-	for i := rs.pos; i < rs.len; i++ {
-		newP := rs.tokens[i].Type.Priority()
-		if newP < p {
-			p = newP
-		}
+// enter goes one level deeper into the recursive calls of the parser,
+// it fails beyond maxDepth so that the stack cannot be exhausted by nested expressions
+func (rs *lexerStream) enter() error {
+	rs.depth++
+	if rs.maxDepth <= 0 || rs.depth <= rs.maxDepth {
+		return nil
 	}
-	return p
+	pos, end := rs.prevEnd(), rs.prevEnd()
+	if rs.notEOF() {
+		pos, end = rs.peek().Pos, rs.peek().End
+	}
+	return newLimitError(ErrTooDeep, pos, end, "expression is deeper than %d", rs.maxDepth)
+}
+
+func (rs *lexerStream) leave() {
+	rs.depth--
 }
@@ -0,0 +1,97 @@
+package goexpr
+
+import (
+	"reflect"
+	"unicode/utf8"
+)
+
+// Limits bounds the resources an expression may use, so that expressions written by untrusted users
+// cannot exhaust the CPU, the memory or the stack. a zero field means no limit
+type Limits struct {
+	MaxInputLength  int // bytes of the input, checked by NewExpr
+	MaxDepth        int // depth of the AST, checked by NewExpr
+	MaxNodes        int // nodes of the AST, checked by NewExpr
+	MaxSteps        int // instructions run by an evaluation, checked by Eval
+	MaxStringLength int // bytes of a string produced by an operator, a function or a method, checked by Eval
+	MaxArrayLength  int // elements of an array or a slice produced by an operator, a function or a method, checked by Eval
+}
+
+// checkInput fails when the input is longer than allowed, the error spans the part beyond the limit
+func (l *Limits) checkInput(input string) error {
+	if l.MaxInputLength <= 0 || len(input) <= l.MaxInputLength {
+		return nil
+	}
+	return newLimitError(ErrInputTooLong, positionAt(input, l.MaxInputLength), positionAt(input, len(input)),
+		"input of %d bytes is longer than %d bytes", len(input), l.MaxInputLength)
+}
+
+// checkTree fails when the AST is deeper or has more nodes than allowed,
+// the error spans the first node beyond the limit
+func (l *Limits) checkTree(root *astNode) error {
+	if l.MaxDepth <= 0 && l.MaxNodes <= 0 {
+		return nil
+	}
+
+	nodes := 0
+	var walk func(node *astNode, depth int) error
+	walk = func(node *astNode, depth int) error {
+		if node == nil {
+			return nil
+		}
+		nodes++
+		if l.MaxDepth > 0 && depth > l.MaxDepth {
+			return newLimitError(ErrTooDeep, node.pos, node.end, "expression is deeper than %d", l.MaxDepth)
+		}
+		if l.MaxNodes > 0 && nodes > l.MaxNodes {
+			return newLimitError(ErrTooManyNodes, node.pos, node.end, "expression has more than %d nodes", l.MaxNodes)
+		}
+		if err := walk(node.left, depth+1); err != nil {
+			return err
+		}
+		if err := walk(node.right, depth+1); err != nil {
+			return err
+		}
+		for _, r := range node.rightList {
+			if err := walk(r, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root, 1)
+}
+
+// checkValue fails when value is a string or an array larger than allowed
+func (l *Limits) checkValue(value interface{}) error {
+	if s, ok := value.(string); ok {
+		if l.MaxStringLength > 0 && len(s) > l.MaxStringLength {
+			return newLimitError(ErrValueTooLarge, Position{}, Position{}, "string of %d bytes is longer than %d bytes", len(s), l.MaxStringLength)
+		}
+		return nil
+	}
+	if l.MaxArrayLength <= 0 || value == nil {
+		return nil
+	}
+	switch val := reflect.ValueOf(value); val.Kind() {
+	case reflect.Slice, reflect.Array:
+		if val.Len() > l.MaxArrayLength {
+			return newLimitError(ErrValueTooLarge, Position{}, Position{}, "array of %d elements is longer than %d elements", val.Len(), l.MaxArrayLength)
+		}
+	}
+	return nil
+}
+
+// positionAt returns the position of the byte at offset in input
+func positionAt(input string, offset int) Position {
+	pos := Position{Line: 1, Column: 1}
+	for pos.Offset < offset && pos.Offset < len(input) {
+		r, size := utf8.DecodeRuneInString(input[pos.Offset:])
+		if r == '\n' {
+			pos.Line, pos.Column = pos.Line+1, 1
+		} else {
+			pos.Column++
+		}
+		pos.Offset += size
+	}
+	return pos
+}
@@ -0,0 +1,176 @@
+package goexpr
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLimitsParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		limits Limits
+		wanted error
+		pos    Position
+	}{
+		{
+			name:   "Input Length",
+			input:  "1 + 2\n+ 3",
+			limits: Limits{MaxInputLength: 7},
+			wanted: ErrInputTooLong,
+			pos:    Position{Offset: 7, Line: 2, Column: 2},
+		},
+		{
+			name:   "Nested Parentheses",
+			input:  strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000),
+			limits: Limits{MaxDepth: 64},
+			wanted: ErrTooDeep,
+			pos:    Position{Offset: 64, Line: 1, Column: 65},
+		},
+		{
+			name:   "Nested Prefix",
+			input:  strings.Repeat("! ", 100000) + "true",
+			limits: Limits{MaxDepth: 64},
+			wanted: ErrTooDeep,
+			pos:    Position{Offset: 128, Line: 1, Column: 129},
+		},
+		{
+			name:   "Left Folded Operators",
+			input:  "1" + strings.Repeat(" + 1", 100),
+			limits: Limits{MaxDepth: 64},
+			wanted: ErrTooDeep,
+			pos:    Position{Offset: 0, Line: 1, Column: 1},
+		},
+		{
+			name:   "Nodes",
+			input:  "[1, 2, 3, 4]",
+			limits: Limits{MaxNodes: 4},
+			wanted: ErrTooManyNodes,
+			pos:    Position{Offset: 10, Line: 1, Column: 11},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := NewExpr(test.input, WithLimits(test.limits))
+		if !errors.Is(err, test.wanted) || !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Test '%s': error %v should be %v", test.name, err, test.wanted)
+			continue
+		}
+		var exprErr *Error
+		if errors.As(err, &exprErr) && exprErr.Pos != test.pos {
+			t.Errorf("Test '%s': error at %+v, wanted at %+v", test.name, exprErr.Pos, test.pos)
+		}
+	}
+}
+
+func TestLimitsWithin(t *testing.T) {
+	limits := Limits{
+		MaxInputLength:  64,
+		MaxDepth:        8,
+		MaxNodes:        32,
+		MaxSteps:        32,
+		MaxStringLength: 8,
+		MaxArrayLength:  3,
+	}
+	expr, err := NewExpr(`(s + "def" ?? "") in [s + "def", "x"] && len(s) < 4`, WithLimits(limits), WithContextFunctions(map[string]ExprContextFunc{
+		"len": func(ctx context.Context, args ...interface{}) (interface{}, error) {
+			return len(args[0].(string)), nil
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := expr.Eval(map[string]interface{}{"s": "abc"}); err != nil || res != true {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+}
+
+func TestLimitsEval(t *testing.T) {
+	params := map[string]interface{}{
+		"s":    "abcd",
+		"x":    5,
+		"list": []interface{}{1, 2, 3, 4},
+	}
+	functions := map[string]ExprFunc{
+		"repeat": func(args ...interface{}) (interface{}, error) {
+			return strings.Repeat(args[0].(string), int(args[1].(int64))), nil
+		},
+	}
+	tests := []struct {
+		input  string
+		limits Limits
+		wanted error
+	}{
+		{"x > 0 && x < 10 && x != 7", Limits{MaxSteps: 8}, ErrTooManySteps},
+		{"s + s + s", Limits{MaxStringLength: 10}, ErrValueTooLarge},
+		{"(s + s + s) ?? \"\"", Limits{MaxStringLength: 10}, ErrValueTooLarge},
+		{"repeat(s, 1000)", Limits{MaxStringLength: 100}, ErrValueTooLarge},
+		{"[x, x, x]", Limits{MaxArrayLength: 2}, ErrValueTooLarge},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExprWithFunctions(test.input, functions, WithLimits(test.limits))
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		_, err = expr.Eval(params)
+		if !errors.Is(err, test.wanted) || !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("input %s: error %v should be %v", test.input, err, test.wanted)
+			continue
+		}
+		var exprErr *Error
+		if !errors.As(err, &exprErr) || exprErr.Pos.Line == 0 {
+			t.Errorf("input %s: error %v should be located", test.input, err)
+		}
+	}
+
+	// parameters are not produced by the evaluation
+	expr, err := NewExpr("list[0] + x", WithLimits(Limits{MaxArrayLength: 2, MaxStringLength: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := expr.Eval(params); err != nil || res != int64(6) {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+}
+
+// a constant value beyond limits fails the compilation once folded,
+// with the error the evaluation of the parsed expression reports
+func TestLimitsFolded(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits Limits
+	}{
+		{`"abc" + "abc"`, Limits{MaxStringLength: 4}},
+		{`x + ("ab" + "ab" + "ab")`, Limits{MaxStringLength: 4}},
+		{"x in [1, 2, 3]", Limits{MaxArrayLength: 2}},
+	}
+
+	for _, test := range tests {
+		_, err := NewExpr(test.input, WithLimits(test.limits))
+		if !errors.Is(err, ErrValueTooLarge) {
+			t.Errorf("input %s: error %v should be a limit of values", test.input, err)
+			continue
+		}
+		expr, parseErr := NewExpr(test.input, WithLimits(test.limits), WithoutOptimization())
+		if parseErr != nil {
+			t.Errorf("input %s failed to parse without optimization: %s", test.input, parseErr)
+			continue
+		}
+		if _, evalErr := expr.Eval(map[string]interface{}{"x": "a"}); evalErr == nil || evalErr.Error() != err.Error() {
+			t.Errorf("input %s: error '%v' does not match the evaluation without optimization: '%v'", test.input, err, evalErr)
+		}
+	}
+
+	// values within limits are folded
+	expr, err := NewExpr(`x + ("ab" + "ab")`, WithLimits(Limits{MaxStringLength: 5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := expr.Eval(map[string]interface{}{"x": "a"}); err != nil || res != "aabab" {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+}
@@ -0,0 +1,521 @@
+package goexpr
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// encodingVersion is the version of the encoding written by MarshalJSON and MarshalBinary,
+// it is increased whenever the encoding changes so that the former encodings are still decoded
+const encodingVersion = 1
+
+// binaryMagic starts the encoding written by MarshalBinary, it tells it apart from JSON
+const binaryMagic = "goexpr\x00"
+
+// exprData is the encoding of an expression: its input, its options and its tree once compiled
+type exprData struct {
+	Version  int       `json:"version"`
+	Input    string    `json:"input"`
+	FieldTag string    `json:"fieldTag,omitempty"`
+	FoldCase bool      `json:"foldCase,omitempty"`
+	Limits   *Limits   `json:"limits,omitempty"`
+	Tree     *nodeData `json:"tree,omitempty"`
+}
+
+// nodeData is the encoding of an AST node, positions are [offset, line, column]
+type nodeData struct {
+	Op    string      `json:"op"`
+	Pos   [3]int      `json:"pos"`
+	End   [3]int      `json:"end"`
+	Left  *nodeData   `json:"left,omitempty"`
+	Right *nodeData   `json:"right,omitempty"`
+	List  []*nodeData `json:"list,omitempty"`
+	Path  []string    `json:"path,omitempty"`
+	Name  string      `json:"name,omitempty"`
+	Value *valueData  `json:"value,omitempty"` // value of constant nodes
+}
+
+// valueData is the encoding of a constant, numbers are written as strings
+// so that int64 and float64 values, including infinities, are decoded exactly
+type valueData struct {
+	Kind  string       `json:"kind"`
+	Value string       `json:"value,omitempty"`
+	Elems []*valueData `json:"elems,omitempty"`
+}
+
+// names of the operators of the nodes within encodings, they never change once released
+var nodeOperators = map[TokenType]string{
+	VARIABLE: "VARIABLE", SELECTOR: "SELECTOR", ACCESSOR: "ACCESSOR", OPTIONAL: "?.",
+	NOT: "!", NEG: "NEG",
+	ADD: "+", SUB: "-", MUL: "*", QUO: "/", REM: "%",
+	AND: "&", OR: "|", XOR: "^", SHL: "<<", SHR: ">>",
+	TERNARY_IF: "?", TERNARY_ELSE: ":",
+	LAND: "&&", LOR: "||", COALESCE: "??",
+	EQ: "==", NEQ: "!=", LT: "<", GT: ">", LEQ: "<=", GEQ: ">=",
+	MATCH: "=~", NOT_MATCH: "!~", IN: "in", NOT_IN: "not in",
+	FUNC: "FUNC", ARRAY: "ARRAY", LITERAL: "LITERAL", CLAUSE: "CLAUSE",
+}
+
+var operatorsByName = func() map[string]TokenType {
+	ops := make(map[string]TokenType, len(nodeOperators))
+	for op, name := range nodeOperators {
+		ops[name] = op
+	}
+	return ops
+}()
+
+// MarshalJSON encodes the compiled expression, it is loaded back by LoadExpr or UnmarshalJSON
+// without being parsed again. the schema of the expression is not encoded
+func (expr *Expr) MarshalJSON() ([]byte, error) {
+	data, err := expr.data()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// MarshalBinary encodes the compiled expression like MarshalJSON, with encoding/gob
+func (expr *Expr) MarshalBinary() ([]byte, error) {
+	data, err := expr.data()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString(binaryMagic)
+	if err = gob.NewEncoder(&b).Encode(data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalJSON loads an expression encoded by MarshalJSON, as LoadExpr does without options:
+// an expression calling functions must be loaded by LoadExprWithFunctions instead
+func (expr *Expr) UnmarshalJSON(b []byte) error {
+	return expr.unmarshal(b)
+}
+
+// UnmarshalBinary loads an expression encoded by MarshalBinary, as UnmarshalJSON does
+func (expr *Expr) UnmarshalBinary(b []byte) error {
+	return expr.unmarshal(b)
+}
+
+func (expr *Expr) unmarshal(b []byte) error {
+	res, err := LoadExpr(b)
+	if err != nil {
+		return err
+	}
+	*expr = *res
+	return nil
+}
+
+// LoadExpr loads an expression encoded by MarshalJSON or MarshalBinary, the calculators
+// and the type checks of the tree are rebuilt, it is neither scanned nor parsed again.
+// the options the expression was compiled with are restored, the given ones are applied on top of them,
+// except WithoutOptimization which has no effect as the tree is loaded as it was compiled.
+// a JSON string is parsed as the input of the expression, as NewExpr does
+func LoadExpr(b []byte, opts ...Option) (*Expr, error) {
+	return LoadExprWithFunctions(b, nil, opts...)
+}
+
+// LoadExprWithFunctions loads an expression like LoadExpr,
+// the functions called by the expression are looked up by their name
+func LoadExprWithFunctions(b []byte, functions map[string]ExprFunc, opts ...Option) (*Expr, error) {
+	var data exprData
+	if bytes.HasPrefix(b, []byte(binaryMagic)) {
+		if err := gob.NewDecoder(bytes.NewReader(b[len(binaryMagic):])).Decode(&data); err != nil {
+			return nil, newEncodingError("invalid binary encoding: %v", err)
+		}
+	} else {
+		var input string
+		if err := json.Unmarshal(b, &input); err == nil {
+			return NewExprWithFunctions(input, functions, opts...)
+		}
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, newEncodingError("invalid JSON encoding: %v", err)
+		}
+	}
+
+	// a later version may encode things this version knows nothing about
+	if data.Version != encodingVersion {
+		return nil, newEncodingError("unsupported encoding version %d", data.Version)
+	}
+
+	restore := func(o *options) {
+		o.fields = fieldNaming{tag: data.FieldTag, foldCase: data.FoldCase}
+		o.limits = data.Limits
+	}
+	options := newOptions(append([]Option{restore}, opts...))
+	res := &Expr{
+		input:  data.Input,
+		fields: options.fields,
+		limits: options.limits,
+	}
+	if options.limits != nil {
+		if err := options.limits.checkInput(data.Input); err != nil {
+			return nil, withInput(err, data.Input)
+		}
+	}
+
+	var err error
+	l := loader{input: data.Input, functions: options.allFunctions(functions)}
+	if res.astNode, err = l.node(data.Tree, false); err != nil {
+		return nil, withInput(err, data.Input)
+	}
+	if res.astNode == nil && strings.TrimSpace(data.Input) != "" {
+		return nil, newEncodingError("missing tree of the input")
+	}
+	if err = res.check(options); err != nil {
+		return nil, withInput(err, data.Input)
+	}
+	res.program = compile(res.astNode)
+	return res, nil
+}
+
+func newEncodingError(format string, args ...interface{}) *Error {
+	return &Error{
+		Kind: ErrInvalidEncoding,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (expr *Expr) data() (*exprData, error) {
+	tree, err := encodeNode(expr.astNode)
+	if err != nil {
+		return nil, err
+	}
+	return &exprData{
+		Version:  encodingVersion,
+		Input:    expr.input,
+		FieldTag: expr.fields.tag,
+		FoldCase: expr.fields.foldCase,
+		Limits:   expr.limits,
+		Tree:     tree,
+	}, nil
+}
+
+func encodeNode(node *astNode) (*nodeData, error) {
+	if node == nil {
+		return nil, nil
+	}
+	name, ok := nodeOperators[node.operator]
+	if !ok {
+		return nil, newEncodingError("cannot encode the operator %v", node.operator)
+	}
+	data := &nodeData{
+		Op:   name,
+		Pos:  [3]int{node.pos.Offset, node.pos.Line, node.pos.Column},
+		End:  [3]int{node.end.Offset, node.end.Line, node.end.Column},
+		Path: node.path,
+		Name: node.name,
+	}
+	var err error
+	if node.constant {
+		data.Value, err = encodeValue(node.value)
+		return data, err
+	}
+	if data.Left, err = encodeNode(node.left); err != nil {
+		return nil, err
+	}
+	if data.Right, err = encodeNode(node.right); err != nil {
+		return nil, err
+	}
+	for _, r := range node.rightList {
+		elem, err := encodeNode(r)
+		if err != nil {
+			return nil, err
+		}
+		data.List = append(data.List, elem)
+	}
+	return data, nil
+}
+
+func encodeValue(value interface{}) (*valueData, error) {
+	switch v := value.(type) {
+	case nil:
+		return &valueData{Kind: "nil"}, nil
+	case bool:
+		return &valueData{Kind: "bool", Value: strconv.FormatBool(v)}, nil
+	case int64:
+		return &valueData{Kind: "int", Value: strconv.FormatInt(v, 10)}, nil
+	case float64:
+		return &valueData{Kind: "float", Value: strconv.FormatFloat(v, 'g', -1, 64)}, nil
+	case string:
+		return &valueData{Kind: "string", Value: v}, nil
+	case rune:
+		return &valueData{Kind: "char", Value: strconv.FormatInt(int64(v), 10)}, nil
+	case []interface{}:
+		data := &valueData{Kind: "array", Elems: make([]*valueData, len(v))}
+		for i, elem := range v {
+			var err error
+			if data.Elems[i], err = encodeValue(elem); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+	return nil, newEncodingError("cannot encode the constant %v of type %T", value, value)
+}
+
+// loader rebuilds the AST from its encoding, as the parser builds it
+type loader struct {
+	input     string
+	functions map[string]ExprContextFunc
+}
+
+// node rebuilds the node encoded by data, branch tells whether it is the branch of a ternary,
+// which is the only place where the else part of a ternary is found
+func (l loader) node(data *nodeData, branch bool) (*astNode, error) {
+	if data == nil {
+		return nil, nil
+	}
+	op, ok := operatorsByName[data.Op]
+	if !ok {
+		return nil, newEncodingError("unknown operator %q", data.Op)
+	}
+	if op == TERNARY_ELSE && !branch {
+		return nil, newEncodingError("else part of a ternary outside of a ternary")
+	}
+	pos := Position{Offset: data.Pos[0], Line: data.Pos[1], Column: data.Pos[2]}
+	end := Position{Offset: data.End[0], Line: data.End[1], Column: data.End[2]}
+	if !l.validSpan(pos, end) {
+		return nil, newEncodingError("invalid span %v to %v of the operator %q", data.Pos, data.End, data.Op)
+	}
+	invalid := func() error {
+		e := newEncodingError("invalid node of the operator %q", data.Op)
+		e.Pos, e.End = pos, end
+		return e
+	}
+
+	if data.Value != nil {
+		if op != LITERAL {
+			return nil, invalid()
+		}
+		value, err := decodeValue(data.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &astNode{
+			operator:   LITERAL,
+			calculator: calculatorLITERAL(value),
+			pos:        pos,
+			end:        end,
+			constant:   true,
+			value:      value,
+		}, nil
+	}
+
+	left, err := l.node(data.Left, false)
+	if err != nil {
+		return nil, err
+	}
+	right, err := l.node(data.Right, op == TERNARY_IF)
+	if err != nil {
+		return nil, err
+	}
+	var rightList []*astNode
+	if op == FUNC || op == ARRAY {
+		// the arguments and the elements are a list even when empty
+		rightList = make([]*astNode, 0, len(data.List))
+	}
+	for _, elem := range data.List {
+		if elem == nil {
+			return nil, invalid()
+		}
+		r, err := l.node(elem, false)
+		if err != nil {
+			return nil, err
+		}
+		rightList = append(rightList, r)
+	}
+
+	node := &astNode{
+		operator:  op,
+		left:      left,
+		right:     right,
+		rightList: rightList,
+		path:      data.Path,
+		name:      data.Name,
+		pos:       pos,
+		end:       end,
+	}
+	switch op {
+	case VARIABLE:
+		if len(node.path) != 1 {
+			return nil, invalid()
+		}
+		node.calculator, node.err = calculatorVARIABLE(node.path[0]), errSelectorFormat
+	case SELECTOR:
+		if len(node.path) == 0 {
+			return nil, invalid()
+		}
+		node.calculator, node.err = calculatorSELECTOR(node.path), errSelectorFormat
+	case ACCESSOR:
+		if len(node.path) == 0 {
+			return nil, invalid()
+		}
+		node.calculator, node.err = calculatorACCESSOR(node.path), errAccessorFormat
+	case LITERAL, OPTIONAL:
+		// path segments following a method or ?.
+		if left == nil || len(rightList) == 0 {
+			return nil, invalid()
+		}
+		node.calculator, node.err = calculatorINDEX, errAccessorFormat
+		if op == OPTIONAL {
+			node.calculator = calculatorOPTIONAL
+		}
+	case FUNC:
+		if node.name == "" {
+			return nil, invalid()
+		}
+		if left != nil {
+			node.calculator = calculatorMETHOD(node.name)
+			break
+		}
+		function, ok := l.functions[node.name]
+		if !ok {
+			return nil, newSyntaxError(pos, end, "undefined function '%s'", node.name)
+		}
+		node.calculator = calculatorFUNC(node.name, function)
+	case ARRAY:
+		node.calculator = calculatorARRAY
+	case CLAUSE:
+		if right == nil {
+			return nil, invalid()
+		}
+		node.calculator = calculatorCLAUSE
+	default:
+		// prefix operators have no left operand
+		_, prefix := tokenPREFIX[op]
+		if right == nil || (left == nil) != prefix {
+			return nil, invalid()
+		}
+		node = buildOperatorNode(LexerToken{Type: op, Pos: pos}, left, right)
+		node.pos, node.end = pos, end
+		if _, ok := tokenMATCH[op]; ok {
+			if err = compileConstantPattern(node); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !l.matches(node) {
+		e := newEncodingError("node of the operator %q does not match the input", data.Op)
+		e.Pos, e.End = pos, end
+		return nil, e
+	}
+	return node, nil
+}
+
+// validSpan reports whether pos and end are positions of the input, end not being before pos
+func (l loader) validSpan(pos, end Position) bool {
+	if pos.Offset < 0 || end.Offset <= pos.Offset || end.Offset > len(l.input) {
+		return false
+	}
+	if !utf8.RuneStart(l.input[pos.Offset]) || (end.Offset < len(l.input) && !utf8.RuneStart(l.input[end.Offset])) {
+		return false
+	}
+	return positionAt(l.input, pos.Offset) == pos && positionAt(l.input, end.Offset) == end
+}
+
+// matches reports whether the operands of node are within its span, and its source is the one
+// the parser gives such a node: the names of parameters, fields, functions and methods,
+// and the operator between the operands are found in the input. literals cannot be checked
+// as constant subtrees are folded
+func (l loader) matches(node *astNode) bool {
+	operands := append([]*astNode{node.left, node.right}, node.rightList...)
+	for _, operand := range operands {
+		if operand != nil && (operand.pos.Offset < node.pos.Offset || operand.end.Offset > node.end.Offset) {
+			return false
+		}
+	}
+
+	// names are followed by the rest of the input, so that a is not found in ab
+	source, text := l.input[node.pos.Offset:], l.input[node.pos.Offset:node.end.Offset]
+	switch node.operator {
+	case VARIABLE, SELECTOR:
+		name := strings.Join(node.path, ".")
+		return len(name) <= len(text) && startsWithName(source, name)
+	case ACCESSOR:
+		name := strings.Join(node.path, ".")
+		return len(name) <= len(text) && startsWithName(strings.TrimPrefix(source, "."), name)
+	case FUNC:
+		if node.left == nil {
+			return len(node.name) < len(text) && startsWithName(source, node.name)
+		}
+		return strings.Contains(l.input[node.left.pos.Offset:node.end.Offset], "."+node.name)
+	case ARRAY:
+		return strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]")
+	case CLAUSE:
+		return strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")")
+	case LITERAL:
+		// path segments following a method
+		return true
+	case OPTIONAL:
+		return strings.Contains(text, "?.")
+	}
+
+	// the operator is found between the operands, or before the operand of a prefix operator
+	from := node.pos.Offset
+	if node.left != nil {
+		from = node.left.end.Offset
+	}
+	if from > node.right.pos.Offset {
+		return false
+	}
+	between := strings.Join(strings.Fields(l.input[from:node.right.pos.Offset]), " ")
+	return strings.Contains(between, node.operator.String())
+}
+
+// startsWithName reports whether text starts with the name, which is not followed by other letters
+func startsWithName(text, name string) bool {
+	if name == "" || !strings.HasPrefix(text, name) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(text[len(name):])
+	return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+func decodeValue(data *valueData) (interface{}, error) {
+	var (
+		value interface{}
+		err   error
+	)
+	switch data.Kind {
+	case "nil":
+		return nil, nil
+	case "bool":
+		value, err = strconv.ParseBool(data.Value)
+	case "int":
+		value, err = strconv.ParseInt(data.Value, 10, 64)
+	case "float":
+		value, err = strconv.ParseFloat(data.Value, 64)
+	case "string":
+		return data.Value, nil
+	case "char":
+		var r int64
+		r, err = strconv.ParseInt(data.Value, 10, 32)
+		value = rune(r)
+	case "array":
+		elems := make([]interface{}, len(data.Elems))
+		for i, elem := range data.Elems {
+			if elem == nil {
+				return nil, newEncodingError("invalid element of an array constant")
+			}
+			if elems[i], err = decodeValue(elem); err != nil {
+				return nil, err
+			}
+		}
+		return elems, nil
+	default:
+		return nil, newEncodingError("unknown kind of constant %q", data.Kind)
+	}
+	if err != nil {
+		return nil, newEncodingError("invalid %s constant %q", data.Kind, data.Value)
+	}
+	return value, nil
+}
@@ -0,0 +1,240 @@
+package goexpr
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a loaded expression has the same tree as the original one and evaluates to the same results and errors
+func TestMarshalRoundTrip(t *testing.T) {
+	params := map[string]interface{}{
+		"x":       int64(7),
+		"f":       2.5,
+		"s":       "abc",
+		"ok":      true,
+		"list":    []interface{}{10, 20, 30},
+		"user":    map[string]interface{}{"name": "Bob", "nickname": nil},
+		"profile": &testProfile{Address: &testAddress{City: "Paris"}},
+		"bob":     &testUser{First: "Bob", Last: "Smith"},
+	}
+	inputs := []string{
+		"1 + 2 * 3 - 4 / 5",
+		"-(x - 1) * -f + (x % 4 << 1)",
+		"x > 5 && f < 3 || !ok",
+		"x > 5 ? x > 6 ? 1 : 2 : 3",
+		"x < 5 ? 1",
+		"list[1] + list[x - 5]",
+		"list[3]",
+		"user.nickname ?? user.name",
+		"user.alias ?? missing ?? user.name",
+		`profile?.Address?.City == "Paris"`,
+		"x in [1, x, 3] && s not in []",
+		`x in [1, 'a', "b", 2.5, nil, true, [1]]`,
+		`s =~ "^a" && s !~ "c$" && s =~ s`,
+		"[x, [s], nil, []]",
+		"bob.FullName() + bob.Greet(\"Hi\")",
+		"bob.FullName()[0]",
+		"bob.BestFriend()?.First",
+		"f + 1.0 / 0 + 0.1",
+		"x + (-9223372036854775807 - 1)",
+		"'é' + 1",
+		"1 / (x - 7)",
+		"unknown > 1",
+		"",
+	}
+
+	for _, opts := range [][]Option{nil, {WithoutOptimization()}} {
+		for _, input := range inputs {
+			expr, err := NewExprWithFunctions(input, testFunctions, opts...)
+			if err != nil {
+				t.Errorf("input %s failed to parse: %s", input, err)
+				continue
+			}
+			wanted, wantedErr := expr.Eval(params)
+
+			encoded, err := expr.MarshalJSON()
+			if err != nil {
+				t.Errorf("input %s failed to be encoded: %s", input, err)
+				continue
+			}
+			binary, err := expr.MarshalBinary()
+			if err != nil {
+				t.Errorf("input %s failed to be encoded: %s", input, err)
+				continue
+			}
+
+			for _, b := range [][]byte{encoded, binary} {
+				loaded, err := LoadExprWithFunctions(b, testFunctions)
+				if err != nil {
+					t.Errorf("input %s failed to be loaded: %s", input, err)
+					continue
+				}
+				if a, b := formatTestNode(loaded.AST()), formatTestNode(expr.AST()); a != b {
+					t.Errorf("input %s: loaded tree %s does not match %s", input, a, b)
+				}
+				if !reflect.DeepEqual(loaded.AST(), expr.AST()) {
+					t.Errorf("input %s: spans or values of the loaded tree do not match", input)
+				}
+				res, err := loaded.Eval(params)
+				if !reflect.DeepEqual(res, wanted) {
+					t.Errorf("input %s: loaded result '%v' does not match '%v'", input, res, wanted)
+				}
+				if (err == nil) != (wantedErr == nil) || (err != nil && err.Error() != wantedErr.Error()) {
+					t.Errorf("input %s: loaded error '%v' does not match '%v'", input, err, wantedErr)
+				}
+			}
+		}
+	}
+}
+
+func TestMarshalField(t *testing.T) {
+	type rule struct {
+		Name string
+		When *Expr
+	}
+	expr, err := NewExpr("age >= 18 && country in [\"FR\", \"DE\"]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(rule{Name: "adult", When: expr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r rule
+	if err = json.Unmarshal(b, &r); err != nil {
+		t.Fatal(err)
+	}
+	res, err := r.When.Eval(map[string]interface{}{"age": 20, "country": "FR"})
+	if err != nil || res != true {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+
+	// rules stored as their input are parsed
+	if err = json.Unmarshal([]byte(`{"Name": "minor", "When": "age < 18"}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = r.When.Eval(map[string]interface{}{"age": 20}); err != nil || res != false {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+}
+
+func TestMarshalOptions(t *testing.T) {
+	payload := &testPayload{UserID: 42, Address: &testAddress{City: "Paris"}}
+	expr, err := NewExpr("user_id + 1", WithFieldTag("json"), WithLimits(Limits{MaxSteps: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := expr.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the field tag and the limits are restored
+	var loaded Expr
+	if err = loaded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loaded.EvalStruct(payload); !errors.Is(err, ErrTooManySteps) {
+		t.Errorf("error %v should be a limit of steps", err)
+	}
+
+	// and the given options are applied on top of them
+	more, err := LoadExpr(b, WithLimits(Limits{MaxSteps: 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := more.EvalStruct(payload); err != nil || res != int64(43) {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+	if _, err = LoadExpr(b, WithLimits(Limits{MaxNodes: 2})); !errors.Is(err, ErrTooManyNodes) {
+		t.Errorf("error %v should be a limit of nodes", err)
+	}
+}
+
+func TestMarshalFunctions(t *testing.T) {
+	functions := map[string]ExprFunc{
+		"double": func(args ...interface{}) (interface{}, error) { return args[0].(int64) * 2, nil },
+	}
+	expr, err := NewExprWithFunctions("double(x) + 1", functions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded Expr
+	if err = json.Unmarshal(b, &loaded); !errors.Is(err, ErrSyntax) || !strings.Contains(err.Error(), "undefined function 'double'") {
+		t.Errorf("error %v should report the undefined function", err)
+	}
+	l, err := LoadExprWithFunctions(b, functions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := l.Eval(map[string]interface{}{"x": 2}); err != nil || res != int64(5) {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+}
+
+func TestLoadExprErrors(t *testing.T) {
+	const a = `{"op": "VARIABLE", "pos": [0, 1, 1], "end": [1, 1, 2], "path": ["a"]}`
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"later version", `{"version": 2, "input": "a", "tree": ` + a + `}`},
+		{"missing version", `{"input": "a", "tree": ` + a + `}`},
+		{"unknown operator", `{"version": 1, "input": "a", "tree": {"op": "**", "pos": [0, 1, 1], "end": [1, 1, 2]}}`},
+		{"missing operand", `{"version": 1, "input": "a +", "tree": {"op": "+", "pos": [0, 1, 1], "end": [3, 1, 4], "left": ` + a + `}}`},
+		{"prefix with left operand", `{"version": 1, "input": "!a", "tree": {"op": "!", "pos": [0, 1, 1], "end": [2, 1, 3], "left": ` + a + `, "right": ` + a + `}}`},
+		{"variable without name", `{"version": 1, "input": "a", "tree": {"op": "VARIABLE", "pos": [0, 1, 1], "end": [1, 1, 2]}}`},
+		{"else outside of ternary", `{"version": 1, "input": "a : a", "tree": {"op": ":", "pos": [0, 1, 1], "end": [5, 1, 6], "left": ` + a + `, "right": ` + a + `}}`},
+		{"unknown constant", `{"version": 1, "input": "1", "tree": {"op": "LITERAL", "pos": [0, 1, 1], "end": [1, 1, 2], "value": {"kind": "complex", "value": "1i"}}}`},
+		{"invalid constant", `{"version": 1, "input": "1", "tree": {"op": "LITERAL", "pos": [0, 1, 1], "end": [1, 1, 2], "value": {"kind": "int", "value": "1.5"}}}`},
+		{"invalid JSON", `{"version": 1,`},
+		{"invalid binary", binaryMagic + "garbage"},
+
+		// tampered encodings, which do not match their input
+		{"end beyond the input", `{"version": 1, "input": "a + 1", "tree": {"op": "+", "pos": [0, 1, 1], "end": [500, 1, 501], "left": ` + a + `, "right": {"op": "LITERAL", "pos": [4, 1, 5], "end": [5, 1, 6], "value": {"kind": "int", "value": "1"}}}}`},
+		{"end before start", `{"version": 1, "input": "a", "tree": {"op": "VARIABLE", "pos": [1, 1, 2], "end": [0, 1, 1], "path": ["a"]}}`},
+		{"negative offset", `{"version": 1, "input": "a", "tree": {"op": "VARIABLE", "pos": [-1, 1, 0], "end": [1, 1, 2], "path": ["a"]}}`},
+		{"missing span", `{"version": 1, "input": "a", "tree": {"op": "VARIABLE", "path": ["a"]}}`},
+		{"wrong column", `{"version": 1, "input": "a", "tree": {"op": "VARIABLE", "pos": [0, 1, 1], "end": [1, 1, 9], "path": ["a"]}}`},
+		{"span within a character", `{"version": 1, "input": "é", "tree": {"op": "VARIABLE", "pos": [0, 1, 1], "end": [1, 1, 2], "path": ["é"]}}`},
+		{"other variable", `{"version": 1, "input": "zzz", "tree": {"op": "VARIABLE", "pos": [0, 1, 1], "end": [1, 1, 2], "path": ["z"]}}`},
+		{"variable of other input", `{"version": 1, "input": "zzz", "tree": ` + a + `}`},
+		{"variable beyond its span", `{"version": 1, "input": "zzz", "tree": {"op": "VARIABLE", "pos": [0, 1, 1], "end": [1, 1, 2], "path": ["zzz"]}}`},
+		{"other operator", `{"version": 1, "input": "a - a", "tree": {"op": "+", "pos": [0, 1, 1], "end": [5, 1, 6], "left": ` + a + `, "right": {"op": "VARIABLE", "pos": [4, 1, 5], "end": [5, 1, 6], "path": ["a"]}}}`},
+		{"operand outside of its node", `{"version": 1, "input": "a + a", "tree": {"op": "!", "pos": [2, 1, 3], "end": [5, 1, 6], "right": ` + a + `}}`},
+		{"other function", `{"version": 1, "input": "max(a)", "tree": {"op": "FUNC", "pos": [0, 1, 1], "end": [6, 1, 7], "list": [{"op": "VARIABLE", "pos": [4, 1, 5], "end": [5, 1, 6], "path": ["a"]}], "name": "len"}}`},
+		{"missing tree", `{"version": 1, "input": "a"}`},
+		{"tree without input", `{"version": 1, "input": "", "tree": ` + a + `}`},
+	}
+
+	for _, test := range tests {
+		if _, err := LoadExprWithFunctions([]byte(test.data), testFunctions); !errors.Is(err, ErrInvalidEncoding) {
+			t.Errorf("%s: error %v should be an invalid encoding", test.name, err)
+		}
+	}
+
+	// the encodings are valid once untampered
+	for _, data := range []string{
+		`{"version": 1, "input": "a", "tree": ` + a + `}`,
+		`{"version": 1, "input": "a - a", "tree": {"op": "-", "pos": [0, 1, 1], "end": [5, 1, 6], "left": ` + a + `, "right": {"op": "VARIABLE", "pos": [4, 1, 5], "end": [5, 1, 6], "path": ["a"]}}}`,
+		`{"version": 1, "input": "max(a)", "tree": {"op": "FUNC", "pos": [0, 1, 1], "end": [6, 1, 7], "list": [{"op": "VARIABLE", "pos": [4, 1, 5], "end": [5, 1, 6], "path": ["a"]}], "name": "max"}}`,
+	} {
+		expr, err := LoadExprWithFunctions([]byte(data), testFunctions)
+		if err != nil {
+			t.Errorf("%s failed to load: %s", data, err)
+			continue
+		}
+		if _, _, err = expr.EvalTrace(map[string]interface{}{"a": 1}); err != nil {
+			t.Errorf("%s failed to be traced: %s", data, err)
+		}
+	}
+}
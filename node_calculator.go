@@ -1,6 +1,7 @@
 package goexpr
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"reflect"
@@ -13,103 +14,125 @@ var (
 	_false = interface{}(false)
 )
 
-func calculatorEQ(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return convertBool2Interface(reflect.DeepEqual(left, right)), nil
+func calculatorEQ(left, right interface{}, ctx evalContext) (interface{}, error) {
+	return convertBool2Interface(isEqual(left, right)), nil
 }
-func calculatorNEQ(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return convertBool2Interface(!reflect.DeepEqual(left, right)), nil
+func calculatorNEQ(left, right interface{}, ctx evalContext) (interface{}, error) {
+	return convertBool2Interface(!isEqual(left, right)), nil
 }
-func calculatorGT(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+func calculatorGT(left, right interface{}, ctx evalContext) (interface{}, error) {
 	if isString(left) && isString(right) {
 		return convertBool2Interface(left.(string) > right.(string)), nil
 	}
-	return convertBool2Interface(left.(float64) > right.(float64)), nil
+	return convertBool2Interface(compareNumbers(left, right) > 0), nil
 }
-func calculatorGEQ(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+func calculatorGEQ(left, right interface{}, ctx evalContext) (interface{}, error) {
 	if isString(left) && isString(right) {
 		return convertBool2Interface(left.(string) >= right.(string)), nil
 	}
-	return convertBool2Interface(left.(float64) >= right.(float64)), nil
+	return convertBool2Interface(compareNumbers(left, right) >= 0), nil
 }
-func calculatorLT(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+func calculatorLT(left, right interface{}, ctx evalContext) (interface{}, error) {
 	if isString(left) && isString(right) {
 		return convertBool2Interface(left.(string) < right.(string)), nil
 	}
-	return convertBool2Interface(left.(float64) < right.(float64)), nil
+	return convertBool2Interface(compareNumbers(left, right) < 0), nil
 }
-func calculatorLEQ(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+func calculatorLEQ(left, right interface{}, ctx evalContext) (interface{}, error) {
 	if isString(left) && isString(right) {
 		return convertBool2Interface(left.(string) <= right.(string)), nil
 	}
-	return convertBool2Interface(left.(float64) <= right.(float64)), nil
+	return convertBool2Interface(compareNumbers(left, right) <= 0), nil
 }
-func calculatorADD(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+func calculatorADD(left, right interface{}, ctx evalContext) (interface{}, error) {
 	if isString(left) || isString(right) {
 		return fmt.Sprintf("%v%v", left, right), nil
 	}
-	return left.(float64) + right.(float64), nil
+	if isInt64(left) && isInt64(right) {
+		return addInt64(left.(int64), right.(int64))
+	}
+	return toFloat64(left) + toFloat64(right), nil
 }
-func calculatorSUB(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return left.(float64) - right.(float64), nil
+func calculatorSUB(left, right interface{}, ctx evalContext) (interface{}, error) {
+	if isInt64(left) && isInt64(right) {
+		return subInt64(left.(int64), right.(int64))
+	}
+	return toFloat64(left) - toFloat64(right), nil
 }
-func calculatorMUL(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return left.(float64) * right.(float64), nil
+func calculatorMUL(left, right interface{}, ctx evalContext) (interface{}, error) {
+	if isInt64(left) && isInt64(right) {
+		return mulInt64(left.(int64), right.(int64))
+	}
+	return toFloat64(left) * toFloat64(right), nil
 }
-func calculatorQUO(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return left.(float64) / right.(float64), nil
+func calculatorQUO(left, right interface{}, ctx evalContext) (interface{}, error) {
+	if isInt64(left) && isInt64(right) {
+		return quoInt64(left.(int64), right.(int64))
+	}
+	return toFloat64(left) / toFloat64(right), nil
 }
-func calculatorREM(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return math.Mod(left.(float64), right.(float64)), nil
+func calculatorREM(left, right interface{}, ctx evalContext) (interface{}, error) {
+	if isInt64(left) && isInt64(right) {
+		return remInt64(left.(int64), right.(int64))
+	}
+	return math.Mod(toFloat64(left), toFloat64(right)), nil
 }
-func calculatorNEG(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+func calculatorNEG(left, right interface{}, ctx evalContext) (interface{}, error) {
+	if isInt64(right) {
+		return negInt64(right.(int64))
+	}
 	return -right.(float64), nil
 }
-func calculatorNOT(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+func calculatorNOT(left, right interface{}, ctx evalContext) (interface{}, error) {
 	return convertBool2Interface(!right.(bool)), nil
 }
-func calculatorLAND(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+func calculatorLAND(left, right interface{}, ctx evalContext) (interface{}, error) {
 	return convertBool2Interface(left.(bool) && right.(bool)), nil
 }
-func calculatorLOR(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+func calculatorLOR(left, right interface{}, ctx evalContext) (interface{}, error) {
 	return convertBool2Interface(left.(bool) || right.(bool)), nil
 }
-func calculatorAND(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return float64(int64(left.(float64)) & int64(right.(float64))), nil
+func calculatorAND(left, right interface{}, ctx evalContext) (interface{}, error) {
+	return toInt64(left) & toInt64(right), nil
 }
-func calculatorOR(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return float64(int64(left.(float64)) | int64(right.(float64))), nil
+func calculatorOR(left, right interface{}, ctx evalContext) (interface{}, error) {
+	return toInt64(left) | toInt64(right), nil
 }
-func calculatorXOR(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return float64(int64(left.(float64)) ^ int64(right.(float64))), nil
+func calculatorXOR(left, right interface{}, ctx evalContext) (interface{}, error) {
+	return toInt64(left) ^ toInt64(right), nil
 }
-func calculatorSHL(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return float64(int64(left.(float64)) << int64(right.(float64))), nil
+func calculatorSHL(left, right interface{}, ctx evalContext) (interface{}, error) {
+	return shlInt64(toInt64(left), toInt64(right))
 }
-func calculatorSHR(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	return float64(int64(left.(float64)) >> int64(right.(float64))), nil
+func calculatorSHR(left, right interface{}, ctx evalContext) (interface{}, error) {
+	return shrInt64(toInt64(left), toInt64(right))
 }
-func calculatorTernaryIf(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	if left.(bool) { // left ? right : ...
-		return right, nil
-	}
-	return nil, nil
+
+// calculatorCOALESCE is only reached when left is nil
+func calculatorCOALESCE(left, right interface{}, ctx evalContext) (interface{}, error) {
+	return right, nil
 }
-func calculatorTernaryElse(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-	if left != nil { // ... ? left : right
-		return left, nil
-	}
+func calculatorIN(left, right interface{}, ctx evalContext) (interface{}, error) {
+	return convertBool2Interface(contains(right, left)), nil
+}
+func calculatorNOTIN(left, right interface{}, ctx evalContext) (interface{}, error) {
+	return convertBool2Interface(!contains(right, left)), nil
+}
+
+// calculatorARRAY returns the evaluated elements of an array literal
+func calculatorARRAY(left, right interface{}, ctx evalContext) (interface{}, error) {
 	return right, nil
 }
-func calculatorCLAUSE(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+func calculatorCLAUSE(left, right interface{}, ctx evalContext) (interface{}, error) {
 	return right, nil
 }
 func calculatorVARIABLE(paramName string) calculator {
-	return func(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+	return func(left, right interface{}, ctx evalContext) (interface{}, error) {
 		path, err := buildPathFromRight(right, []string{paramName})
 		if err != nil {
 			return nil, err
 		}
-		value, err := extractValueFromParams(params, path)
+		value, err := ctx.params.get(path, ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -117,23 +140,25 @@ func calculatorVARIABLE(paramName string) calculator {
 	}
 }
 func calculatorLITERAL(literal interface{}) calculator {
-	return func(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+	return func(left, right interface{}, ctx evalContext) (interface{}, error) {
 		return literal, nil
 	}
 }
 func calculatorACCESSOR(parts []string) calculator {
-	return func(left, right interface{}, params map[string]interface{}) (interface{}, error) {
+	return func(left, right interface{}, ctx evalContext) (interface{}, error) {
 		return parts, nil
 	}
 }
 func calculatorSELECTOR(parts []string) calculator {
-	return func(left, right interface{}, params map[string]interface{}) (res interface{}, err error) {
-		parts, err = buildPathFromRight(right, parts)
+	return func(left, right interface{}, ctx evalContext) (interface{}, error) {
+		// the capacity is limited so that the path following parts is never written into parts,
+		// which is shared by every evaluation
+		path, err := buildPathFromRight(right, parts[:len(parts):len(parts)])
 		if err != nil {
 			return nil, err
 		}
 
-		value, err := extractValueFromParams(params, parts)
+		value, err := ctx.params.get(path, ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -141,19 +166,56 @@ func calculatorSELECTOR(parts []string) calculator {
 	}
 }
 
-func calculatorFUNC(function ExprFunc) calculator {
-	return func(left, right interface{}, params map[string]interface{}) (interface{}, error) {
-		if right == nil {
-			return function()
+func calculatorFUNC(name string, function ExprContextFunc) calculator {
+	return func(left, right interface{}, ctx evalContext) (interface{}, error) {
+		res, err := function(ctx.context, right.([]interface{})...)
+		if err != nil {
+			return nil, fmt.Errorf("function '%s' failed: %w", name, err)
 		}
-		switch right.(type) {
-		case []interface{}:
-			return function(right.([]interface{})...)
-		default:
-			return function(right)
+		return convert2Number(res), nil
+	}
+}
+
+func calculatorMETHOD(name string) calculator {
+	return func(left, right interface{}, ctx evalContext) (interface{}, error) {
+		res, err := callMethod(left, name, right.([]interface{}))
+		if err != nil {
+			return nil, err
 		}
+		return convert2Number(res), nil
+	}
+}
 
+// calculatorINDEX accesses the path in right from the value of left,
+// used for paths following a method call
+func calculatorINDEX(left, right interface{}, ctx evalContext) (interface{}, error) {
+	path, err := buildPathFromRight(right, []string{})
+	if err != nil {
+		return nil, err
+	}
+	return extractValueFromPath(left, path, ctx.fields)
+}
+
+// calculatorOPTIONAL accesses the path in right from the value of left,
+// it yields nil as soon as a value along the path is nil or misses the next field
+func calculatorOPTIONAL(left, right interface{}, ctx evalContext) (interface{}, error) {
+	path, err := buildPathFromRight(right, []string{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range path {
+		if isNil(left) {
+			return nil, nil
+		}
+		left, err = extractValueFromPath(left, path[i:i+1], ctx.fields)
+		if errors.Is(err, ErrUnknownParameter) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
+	return left, nil
 }
 
 func isString(value interface{}) bool {
@@ -164,22 +226,78 @@ func isString(value interface{}) bool {
 	return false
 }
 
-func isFloat64(value interface{}) bool {
+func isBool(value interface{}) bool {
 	switch value.(type) {
-	case float64:
+	case bool:
 		return true
 	}
 	return false
 }
 
-func isBool(value interface{}) bool {
-	switch value.(type) {
-	case bool:
+func isCollection(value interface{}) bool {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
 		return true
 	}
 	return false
 }
 
+// contains reports whether value is an element of the array or slice collection,
+// or a key of the map collection
+func contains(collection, value interface{}) bool {
+	if elems, ok := collection.([]interface{}); ok {
+		for _, elem := range elems {
+			if isEqual(value, convert2Number(elem)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	val := reflect.ValueOf(collection)
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			if isEqual(value, convert2Number(val.Index(i).Interface())) {
+				return true
+			}
+		}
+	case reflect.Map:
+		key, err := convertArgument(value, val.Type().Key())
+		// a number may not fit into the key type
+		if err != nil || !isEqual(value, convert2Number(key.Interface())) {
+			return false
+		}
+		return val.MapIndex(key).IsValid()
+	}
+	return false
+}
+
+// isNil reports whether value is nil, or a nil pointer, map, slice, function, channel or interface
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	val := reflect.ValueOf(value)
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return val.IsNil()
+	}
+	return false
+}
+
+// isEqual compares numbers by their value whatever their type, and other values deeply,
+// nil is only equal to nil values whatever their type
+func isEqual(left, right interface{}) bool {
+	if isNil(left) || isNil(right) {
+		return isNil(left) && isNil(right)
+	}
+	if isNumber(left) && isNumber(right) {
+		return compareNumbers(left, right) == 0
+	}
+	return reflect.DeepEqual(left, right)
+}
+
 func convertBool2Interface(b bool) interface{} {
 	if b {
 		return _true
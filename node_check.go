@@ -1,13 +1,16 @@
 package goexpr
 
 const (
-	errNumericFormat  string = "value '%v' cannot be used with the numeric operator '%v', it is not a number"
-	errLogicalFormat  string = "value '%v' cannot be used with the logical operator '%v', it is not a bool"
-	errComparerFormat string = "value '%v' cannot be used with the COMPARER operator '%v', it is not a number"
-	errTernaryFormat  string = "value '%v' cannot be used with the ternary operator '%v', it is not a bool"
-	errPrefixFormat   string = "value '%v' cannot be used with the prefix operator '%v'"
-	errSelectorFormat string = "fail to select parameter '%v'"
-	errAccessorFormat string = "fail to access parameter '%v'"
+	errNumericFormat    string = "value '%v' cannot be used with the numeric operator '%v', it is not a number"
+	errLogicalFormat    string = "value '%v' cannot be used with the logical operator '%v', it is not a bool"
+	errIntegerFormat    string = "value '%v' cannot be used with the bitwise operator '%v', it is not an integer"
+	errComparerFormat   string = "value '%v' cannot be used with the COMPARER operator '%v', it is not a number"
+	errMatchFormat      string = "value '%v' cannot be used with the match operator '%v', it is not a string"
+	errMembershipFormat string = "value '%v' cannot be used with the membership operator '%v', it is not an array, a slice or a map"
+	errTernaryFormat    string = "value '%v' cannot be used with the ternary operator '%v', it is not a bool"
+	errPrefixFormat     string = "value '%v' cannot be used with the prefix operator '%v'"
+	errSelectorFormat   string = "fail to select parameter '%v'"
+	errAccessorFormat   string = "fail to access parameter '%v'"
 )
 
 type typeChecks struct {
@@ -24,8 +27,8 @@ func getTypeChecks(op TokenType) typeChecks {
 		}
 	case SUB, MUL, QUO, REM:
 		return typeChecks{
-			left:  isFloat64,
-			right: isFloat64,
+			left:  isNumber,
+			right: isNumber,
 		}
 	case GT, LT, GEQ, LEQ:
 		return typeChecks{
@@ -33,8 +36,17 @@ func getTypeChecks(op TokenType) typeChecks {
 		}
 	case AND, OR, XOR, SHL, SHR:
 		return typeChecks{
-			left:  isFloat64,
-			right: isFloat64,
+			left:  isInteger,
+			right: isInteger,
+		}
+	case MATCH, NOT_MATCH:
+		return typeChecks{
+			left:  isString,
+			right: isString,
+		}
+	case IN, NOT_IN:
+		return typeChecks{
+			right: isCollection,
 		}
 	case LAND, LOR:
 		return typeChecks{
@@ -47,7 +59,7 @@ func getTypeChecks(op TokenType) typeChecks {
 		}
 	case NEG:
 		return typeChecks{
-			right: isFloat64,
+			right: isNumber,
 		}
 	case TERNARY_IF:
 		return typeChecks{
@@ -58,9 +70,32 @@ func getTypeChecks(op TokenType) typeChecks {
 	}
 }
 
+func getErrFormat(op TokenType) string {
+	if _, ok := tokenMATCH[op]; ok {
+		return errMatchFormat
+	}
+	switch op.Priority() {
+	case priorityMUL, priorityADD:
+		return errNumericFormat
+	case priorityBITSHIFT, priorityBIT:
+		return errIntegerFormat
+	case priorityCOMPARER:
+		return errComparerFormat
+	case priorityMEMBERSHIP:
+		return errMembershipFormat
+	case priorityLAND, priorityLOR:
+		return errLogicalFormat
+	case priorityTENARY:
+		return errTernaryFormat
+	case priorityPREFIX:
+		return errPrefixFormat
+	}
+	return ""
+}
+
 func addTypeCheck(left, right interface{}) bool {
 	// both number
-	if isFloat64(left) && isFloat64(right) {
+	if isNumber(left) && isNumber(right) {
 		return true
 	}
 	// or either is string, string concat
@@ -72,7 +107,7 @@ func addTypeCheck(left, right interface{}) bool {
 }
 
 func comparerTypeCheck(left, right interface{}) bool {
-	if isFloat64(left) && isFloat64(right) {
+	if isNumber(left) && isNumber(right) {
 		return true
 	}
 	if isString(left) && isString(right) {
@@ -0,0 +1,160 @@
+package goexpr
+
+import (
+	"fmt"
+	"math"
+)
+
+// numbers are either int64 or float64, integers stay int64 as long as all the operands are integers,
+// and are promoted to float64 as soon as one of the operands is a float64
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+func isInt64(value interface{}) bool {
+	switch value.(type) {
+	case int64:
+		return true
+	}
+	return false
+}
+
+// isInteger reports whether the value can be used as an integer,
+// a float64 without fraction is accepted since decoded JSON numbers are always float64
+func isInteger(value interface{}) bool {
+	switch val := value.(type) {
+	case int64:
+		return true
+	case float64:
+		return val == math.Trunc(val) && val >= math.MinInt64 && val < math.MaxInt64
+	}
+	return false
+}
+
+func toFloat64(value interface{}) float64 {
+	switch val := value.(type) {
+	case int64:
+		return float64(val)
+	case float64:
+		return val
+	}
+	panic(fmt.Sprintf("value '%v' is not a number", value))
+}
+
+func toInt64(value interface{}) int64 {
+	switch val := value.(type) {
+	case int64:
+		return val
+	case float64:
+		return int64(val)
+	}
+	panic(fmt.Sprintf("value '%v' is not an integer", value))
+}
+
+// compareNumbers returns -1, 0 or 1 when left is less than, equal to or greater than right
+func compareNumbers(left, right interface{}) int {
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			switch {
+			case l < r:
+				return -1
+			case l > r:
+				return 1
+			}
+			return 0
+		}
+	}
+	l, r := toFloat64(left), toFloat64(right)
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+func errIntegerOverflow(left interface{}, op TokenType, right interface{}) error {
+	return newEvalError(ErrIntegerOverflow, op, []interface{}{left, right}, "integer overflow: %v %v %v", left, op, right)
+}
+
+func errDivisionByZero(left interface{}, op TokenType, right interface{}) error {
+	return newEvalError(ErrDivisionByZero, op, []interface{}{left, right}, "integer division by zero: %v %v %v", left, op, right)
+}
+
+func addInt64(left, right int64) (int64, error) {
+	if (right > 0 && left > math.MaxInt64-right) || (right < 0 && left < math.MinInt64-right) {
+		return 0, errIntegerOverflow(left, ADD, right)
+	}
+	return left + right, nil
+}
+
+func subInt64(left, right int64) (int64, error) {
+	if (right < 0 && left > math.MaxInt64+right) || (right > 0 && left < math.MinInt64+right) {
+		return 0, errIntegerOverflow(left, SUB, right)
+	}
+	return left - right, nil
+}
+
+func negInt64(right int64) (int64, error) {
+	if right == math.MinInt64 {
+		return 0, newEvalError(ErrIntegerOverflow, NEG, []interface{}{right}, "integer overflow: -(%v)", right)
+	}
+	return -right, nil
+}
+
+// shlInt64 fails when bits are shifted out of the int64, or its sign changes,
+// as 1 << 63 or 1 << 64 would silently give math.MinInt64 and 0
+func shlInt64(left, right int64) (int64, error) {
+	if right < 0 {
+		return 0, newEvalError(ErrIntegerOverflow, SHL, []interface{}{left, right}, "negative shift count %v", right)
+	}
+	if left == 0 {
+		return 0, nil
+	}
+	if right >= 64 || (left<<right)>>right != left {
+		return 0, errIntegerOverflow(left, SHL, right)
+	}
+	return left << right, nil
+}
+
+// shrInt64 is an arithmetic shift, a count of 64 or more gives 0, or -1 for a negative left
+func shrInt64(left, right int64) (int64, error) {
+	if right < 0 {
+		return 0, newEvalError(ErrIntegerOverflow, SHR, []interface{}{left, right}, "negative shift count %v", right)
+	}
+	return left >> right, nil
+}
+
+func mulInt64(left, right int64) (int64, error) {
+	if left == 0 || right == 0 {
+		return 0, nil
+	}
+	res := left * right
+	if res/right != left || (left == -1 && right == math.MinInt64) || (right == -1 && left == math.MinInt64) {
+		return 0, errIntegerOverflow(left, MUL, right)
+	}
+	return res, nil
+}
+
+func quoInt64(left, right int64) (int64, error) {
+	if right == 0 {
+		return 0, errDivisionByZero(left, QUO, right)
+	}
+	if left == math.MinInt64 && right == -1 {
+		return 0, errIntegerOverflow(left, QUO, right)
+	}
+	return left / right, nil
+}
+
+func remInt64(left, right int64) (int64, error) {
+	if right == 0 {
+		return 0, errDivisionByZero(left, REM, right)
+	}
+	return left % right, nil
+}
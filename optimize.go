@@ -0,0 +1,142 @@
+package goexpr
+
+// optimize simplifies the AST before it is compiled:
+// constant subtrees are folded into literals, CLAUSE wrappers are removed,
+// and short-circuit operators with a constant left operand are resolved.
+// a subtree failing to evaluate is kept, so that the error is still reported by Eval,
+// while a folded value beyond limits fails the compilation, as it would fail every evaluation
+func optimize(node *astNode, limits *Limits) (*astNode, error) {
+	if node == nil || node.constant {
+		return node, nil
+	}
+	if node.operator == CLAUSE {
+		return optimize(node.right, limits)
+	}
+
+	var err error
+	if node.left, err = optimize(node.left, limits); err != nil {
+		return nil, err
+	}
+	if node.right, err = optimize(node.right, limits); err != nil {
+		return nil, err
+	}
+	for i, r := range node.rightList {
+		if node.rightList[i], err = optimize(r, limits); err != nil {
+			return nil, err
+		}
+	}
+
+	switch node.operator {
+	case LAND:
+		if node.left.constant && node.left.value == false {
+			return foldedNode(node, _false), nil
+		}
+	case LOR:
+		if node.left.constant && node.left.value == true {
+			return foldedNode(node, _true), nil
+		}
+	case COALESCE:
+		if node.left.constant {
+			if isNil(node.left.value) {
+				return node.right, nil
+			}
+			return node.left, nil
+		}
+	case TERNARY_IF:
+		return optimizeTernary(node), nil
+	case MATCH, NOT_MATCH:
+		// a pattern folded into a literal, as "a" + "(", is compiled as a literal one
+		if err = compileConstantPattern(node); err != nil {
+			return nil, err
+		}
+	case IN, NOT_IN:
+		// the elements of a constant array are never modified by a membership operator,
+		// so that the same array can be shared by every evaluation
+		if node.right.operator == ARRAY && allConstant(node.right.rightList) {
+			if node.right, err = foldNode(node.right, limits); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _, ok := opCalculator[node.operator]; !ok {
+		// parameters, functions, methods and arrays
+		return node, nil
+	}
+	if (node.left != nil && !node.left.constant) || (node.right != nil && !node.right.constant) {
+		return node, nil
+	}
+	return foldNode(node, limits)
+}
+
+// optimizeTernary keeps only the branch chosen by a constant boolean condition
+func optimizeTernary(node *astNode) *astNode {
+	cond := node.left
+	if !cond.constant || !isBool(cond.value) {
+		return node
+	}
+
+	then, otherwise := node.right, (*astNode)(nil)
+	if then.operator == TERNARY_ELSE {
+		then, otherwise = then.left, then.right
+	}
+	if cond.value == true {
+		return then
+	}
+	if otherwise == nil {
+		return foldedNode(node, nil)
+	}
+	return otherwise
+}
+
+// foldNode evaluates node, its operands being constant,
+// node is returned unchanged if the evaluation fails, and an error if the value is beyond limits
+func foldNode(node *astNode, limits *Limits) (*astNode, error) {
+	var (
+		left, right interface{}
+		rightList   []interface{}
+	)
+	if node.left != nil {
+		left = node.left.value
+	}
+	if node.right != nil {
+		right = node.right.value
+	} else if node.rightList != nil {
+		rightList = make([]interface{}, len(node.rightList))
+		for i, r := range node.rightList {
+			rightList[i] = r.value
+		}
+	}
+
+	value, err := call(node, left, right, rightList, &evalContext{})
+	if err != nil {
+		return node, nil
+	}
+	if limits != nil {
+		if err = limits.checkValue(value); err != nil {
+			return nil, wrapError(err, node.pos, node.end)
+		}
+	}
+	return foldedNode(node, value), nil
+}
+
+// foldedNode returns a literal holding value in place of node
+func foldedNode(node *astNode, value interface{}) *astNode {
+	return &astNode{
+		operator:   LITERAL,
+		calculator: calculatorLITERAL(value),
+		pos:        node.pos,
+		end:        node.end,
+		constant:   true,
+		value:      value,
+	}
+}
+
+func allConstant(nodes []*astNode) bool {
+	for _, n := range nodes {
+		if !n.constant {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package goexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOptimizeConstants(t *testing.T) {
+	parseAstTests := []ParseAstTest{
+		{
+			Name:   "Arithmetic",
+			Input:  "(2) + (2) == (4)",
+			Wanted: "true",
+		},
+		{
+			Name:   "Prefix",
+			Input:  "-(1 + 2) * 3",
+			Wanted: "-9",
+		},
+		{
+			Name:   "Ternary",
+			Input:  "1 > 2 ? \"a\" : \"b\"",
+			Wanted: "b",
+		},
+		{
+			Name:   "Ternary Without Else",
+			Input:  "false ? 1",
+			Wanted: "<nil>",
+		},
+		{
+			Name:   "Coalesce",
+			Input:  "nil ?? 3",
+			Wanted: "3",
+		},
+		{
+			Name:   "Membership",
+			Input:  "2 in [1, 1 + 1]",
+			Wanted: "true",
+		},
+		{
+			Name:   "Match",
+			Input:  "\"abc\" =~ \"^a\"",
+			Wanted: "true",
+		},
+		{
+			Name:   "Array Kept",
+			Input:  "[1 + 1, (2)]",
+			Wanted: "[2 2]",
+		},
+		{
+			Name:   "Division By Zero Kept",
+			Input:  "(1 / 0) + 1",
+			Wanted: "(+ (/ 1 0) 1)",
+		},
+		{
+			Name:   "Type Mismatch Kept",
+			Input:  "1 && (true)",
+			Wanted: "(&& 1 true)",
+		},
+	}
+
+	for _, test := range parseAstTests {
+		expr, err := NewExpr(test.Input)
+		if err != nil {
+			t.Errorf("Test '%s' with input %s failed to parse: %s", test.Name, test.Input, err)
+			continue
+		}
+		if res := formatTestAst(expr.astNode); res != test.Wanted {
+			t.Errorf("Test '%s' with input %s: ast %s does not match wanted: %s", test.Name, test.Input, res, test.Wanted)
+		}
+	}
+}
+
+func TestOptimizeInstructions(t *testing.T) {
+	tests := []struct {
+		input     string
+		optimized int
+		parsed    int
+	}{
+		{"x + (2 * 3)", 3, 6},
+		{"true || x", 1, 4},
+		{"false && x", 1, 4},
+		{"(1 < 2) ? x : y", 1, 8},
+		{"nil ?? x", 1, 4},
+		{"x in [1, 2]", 3, 5},
+		{"x in [1, y]", 5, 5},
+		{"max(1 + 1, 1)", 3, 5},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExprWithFunctions(test.input, testFunctions)
+		if err != nil {
+			t.Fatalf("input %s failed to parse: %s", test.input, err)
+		}
+		if n := len(expr.program.instructions); n != test.optimized {
+			t.Errorf("input %s: %d instructions, wanted %d", test.input, n, test.optimized)
+		}
+		expr, err = NewExprWithFunctions(test.input, testFunctions, WithoutOptimization())
+		if err != nil {
+			t.Fatalf("input %s failed to parse: %s", test.input, err)
+		}
+		if n := len(expr.program.instructions); n != test.parsed {
+			t.Errorf("input %s without optimization: %d instructions, wanted %d", test.input, n, test.parsed)
+		}
+	}
+}
+
+// optimized expressions must give the same results and errors as the parsed ones
+func TestOptimizeMatchesParsed(t *testing.T) {
+	params := map[string]interface{}{
+		"x": int64(7),
+		"s": "abc",
+	}
+	inputs := []string{
+		"(2) + (2) == (4)",
+		"x + (2 * 3)",
+		"true || missing",
+		"false && missing",
+		"true && x > 1",
+		"1 && true",
+		"(1 / 0) + x",
+		"9223372036854775807 + 1",
+		"1 + \"a\" == x",
+		"true ? x : missing",
+		"false ? missing",
+		"1 ? x : 2",
+		"nil ?? x",
+		"s ?? missing",
+		"\"a\" ?? missing",
+		"x in [1, 7] && s not in [\"a\", \"b\"]",
+		"[x, 1 + 1]",
+		"\"abc\" !~ \"c$\" || s =~ \"b\"",
+		"-\"a\"",
+	}
+
+	for _, input := range inputs {
+		optimized, err := NewExpr(input)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", input, err)
+			continue
+		}
+		parsed, err := NewExpr(input, WithoutOptimization())
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", input, err)
+			continue
+		}
+		wanted, wantedErr := parsed.Eval(params)
+		res, err := optimized.Eval(params)
+		if !reflect.DeepEqual(res, wanted) {
+			t.Errorf("input %s: result '%v' does not match parsed: '%v'", input, res, wanted)
+		}
+		if (err == nil) != (wantedErr == nil) || (err != nil && err.Error() != wantedErr.Error()) {
+			t.Errorf("input %s: error '%v' does not match parsed: '%v'", input, err, wantedErr)
+		}
+	}
+}
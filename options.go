@@ -0,0 +1,82 @@
+package goexpr
+
+// Option configures how an expression is compiled by NewExpr and NewExprWithFunctions
+type Option func(*options)
+
+type options struct {
+	optimize  bool
+	fields    fieldNaming
+	functions map[string]ExprContextFunc
+	limits    *Limits
+	schema    *Type
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		optimize: true,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// allFunctions returns the functions callable by the expression, functions registered with
+// WithContextFunctions take precedence over the given ones
+func (o *options) allFunctions(functions map[string]ExprFunc) map[string]ExprContextFunc {
+	all := make(map[string]ExprContextFunc, len(functions)+len(o.functions))
+	for name, function := range functions {
+		all[name] = function.withContext()
+	}
+	for name, function := range o.functions {
+		all[name] = function
+	}
+	return all
+}
+
+// WithoutOptimization keeps the expression as it is parsed, constant subtrees
+// are evaluated on every Eval instead of being folded at compile time, which may help debugging
+func WithoutOptimization() Option {
+	return func(o *options) {
+		o.optimize = false
+	}
+}
+
+// WithFieldTag names the fields of structs by their tag with the given key, such as json
+// for `json:"user_id"`, fields without the tag keep their Go name and fields tagged "-" are hidden.
+// as with encoding/json, the fields of an embedded struct are promoted unless the struct is named by its tag
+func WithFieldTag(key string) Option {
+	return func(o *options) {
+		o.fields.tag = key
+	}
+}
+
+// WithCaseInsensitiveFields matches the fields of structs regardless of the case of their names,
+// a field whose name has the exact case is preferred
+func WithCaseInsensitiveFields() Option {
+	return func(o *options) {
+		o.fields.foldCase = true
+	}
+}
+
+// WithContextFunctions registers functions which are given the context of the evaluation,
+// so that they can give up once it is canceled. they take precedence over the functions
+// given to NewExprWithFunctions with the same name
+func WithContextFunctions(functions map[string]ExprContextFunc) Option {
+	return func(o *options) {
+		for name, function := range functions {
+			if o.functions == nil {
+				o.functions = map[string]ExprContextFunc{}
+			}
+			o.functions[name] = function
+		}
+	}
+}
+
+// WithLimits bounds the resources used by the expression, parsing fails with an error matching
+// ErrLimitExceeded when the input or its AST is beyond limits, and so does an evaluation beyond limits
+func WithLimits(limits Limits) Option {
+	return func(o *options) {
+		o.limits = &limits
+	}
+}
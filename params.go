@@ -1,7 +1,10 @@
 package goexpr
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
@@ -30,8 +33,14 @@ func buildPathFromRight(right interface{}, path []string) (res []string, err err
 			rv := reflect.ValueOf(r)
 			if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
 				path = append(path, r.([]string)...)
+			} else if rv.Kind() == reflect.Int64 {
+				path = append(path, strconv.FormatInt(r.(int64), 10))
 			} else if rv.Kind() == reflect.Float64 {
-				path = append(path, strconv.Itoa(int(r.(float64))))
+				key, ok := floatKey(r.(float64))
+				if !ok {
+					return nil, newPathError(ErrTypeMismatch, path, "invalid index %v, it must be an integer", r)
+				}
+				path = append(path, key)
 			} else if rv.Kind() == reflect.String {
 				path = append(path, r.(string))
 			} else {
@@ -40,8 +49,14 @@ func buildPathFromRight(right interface{}, path []string) (res []string, err err
 		}
 	case reflect.String:
 		path = append(path, right.(string))
+	case reflect.Int64:
+		path = append(path, strconv.FormatInt(right.(int64), 10))
 	case reflect.Float64:
-		path = append(path, strconv.Itoa(int(right.(float64))))
+		key, ok := floatKey(right.(float64))
+		if !ok {
+			return nil, newPathError(ErrTypeMismatch, path, "invalid index %v, it must be an integer", right)
+		}
+		path = append(path, key)
 	default:
 		return nil, fmt.Errorf("invalid right value type %s", val.Kind().String())
 	}
@@ -49,93 +64,383 @@ func buildPathFromRight(right interface{}, path []string) (res []string, err err
 	return path, nil
 }
 
-func extractValueFromParams(params map[string]interface{}, path []string) (res interface{}, err error) {
-	expr := strings.Join(path, ".")
+// floatKey returns the part of a path given by a float64 index,
+// which is only valid without fraction and within the int64 range
+func floatKey(f float64) (string, bool) {
+	if !isInteger(f) {
+		return "", false
+	}
+	return strconv.FormatInt(int64(f), 10), true
+}
+
+// Parameters resolves the parameters of an expression evaluated by EvalWith,
+// Get is called with the path of each parameter, such as [user address city] for user.address.city,
+// or [items 0] for items[0]. Get must not modify path.
+//
+// a missing parameter is reported by an error matching ErrUnknownParameter with errors.Is,
+// so that the ?? and ?. operators take it as nil
+type Parameters interface {
+	Get(path []string) (interface{}, error)
+}
+
+// ContextParameters are Parameters that are given the context of EvalContext,
+// GetContext is called in place of Get
+type ContextParameters interface {
+	Parameters
+	GetContext(ctx context.Context, path []string) (interface{}, error)
+}
+
+// parameters are the built-in Parameters, which name the fields of structs along the path as told by ctx
+type parameters interface {
+	get(path []string, ctx evalContext) (interface{}, error)
+}
+
+// MapParameters are the parameters given to Eval, the default implementation of Parameters:
+// the first element of the path is a key of the map, the following ones walk through
+// the fields of structs, the keys of maps and the indexes of slices
+type MapParameters map[string]interface{}
 
+// Get returns the value at path
+func (p MapParameters) Get(path []string) (interface{}, error) {
+	return p.get(path, evalContext{})
+}
+
+func (p MapParameters) get(path []string, ctx evalContext) (interface{}, error) {
 	if len(path) == 0 {
-		return nil, fmt.Errorf("invalid selector path " + expr)
+		return nil, fmt.Errorf("invalid selector path ")
+	}
+	value, ok := p[path[0]]
+	if !ok {
+		return nil, newPathError(ErrUnknownParameter, path[:1], "no parameter %s found", path[0])
 	}
+	return extractValueFromParam(reflect.ValueOf(value), path, ctx.fields)
+}
+
+// structParameters are the exported fields of the struct given to EvalStruct
+type structParameters struct {
+	value  reflect.Value
+	fields *structFields
+}
+
+func newStructParameters(v interface{}, naming fieldNaming) (*structParameters, error) {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, newEvalError(ErrTypeMismatch, nil, []interface{}{v}, "cannot evaluate with %T, it is not a struct", v)
+	}
+	return &structParameters{
+		value:  val,
+		fields: cachedFields(val.Type(), naming),
+	}, nil
+}
 
+func (p *structParameters) get(path []string, ctx evalContext) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("invalid selector path ")
+	}
+	field, ok, err := p.fields.field(p.value, path[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, newPathError(ErrUnknownParameter, path[:1], "no parameter %s found", path[0])
+	}
+	return extractValueFromParam(field, path, ctx.fields)
+}
+
+// resolverParameters are the Parameters given to EvalWith
+type resolverParameters struct {
+	resolver Parameters
+}
+
+// kinds of the errors returned by resolvers which are kept, so that errors.As gives an *Error of the kind
+var resolverErrorKinds = []error{ErrUnknownParameter, ErrTypeMismatch, ErrIndexOutOfRange}
+
+func (p resolverParameters) get(path []string, ctx evalContext) (value interface{}, err error) {
+	// the capacity is limited so that an append by the resolver does not write into path
+	if resolver, ok := p.resolver.(ContextParameters); ok && ctx.context != nil {
+		value, err = resolver.GetContext(ctx.context, path[:len(path):len(path)])
+	} else {
+		value, err = p.resolver.Get(path[:len(path):len(path)])
+	}
+	if err != nil {
+		if _, ok := err.(*Error); ok {
+			return nil, copyError(err)
+		}
+		e := newPathError(nil, path, "failed to get %s: %v", strings.Join(path, "."), err)
+		e.Err = err
+		for _, kind := range resolverErrorKinds {
+			if errors.Is(err, kind) {
+				e.Kind = kind
+				break
+			}
+		}
+		return nil, e
+	}
+	return convert2Number(value), nil
+}
+
+// extractValueFromParam walks through path[1:] from value, the parameter named path[0],
+// the fields of structs along the path are named as told by naming
+func extractValueFromParam(value reflect.Value, path []string, naming fieldNaming) (interface{}, error) {
+	if len(path) == 1 {
+		if !value.IsValid() {
+			return nil, nil
+		}
+		return convert2Number(value.Interface()), nil
+	}
+
+	res, err := walkPath(value, path[1:], naming)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			e.Path = append(path[:1:1], e.Path...)
+			e.Msg = fmt.Sprintf("failed to access %s: %s", strings.Join(path, "."), e.Msg)
+			return nil, e
+		}
+		return nil, fmt.Errorf("failed to access %s: %v", strings.Join(path, "."), err)
+	}
+	return res, nil
+}
+
+// extractValueFromPath walks through struct fields, map keys and slice indexes of value,
+// the Path of a returned *Error is the part of path walked through until the failure
+func extractValueFromPath(value interface{}, path []string, naming fieldNaming) (res interface{}, err error) {
+	return walkPath(reflect.ValueOf(value), path, naming)
+}
+
+// walkPath is extractValueFromPath on a reflected value, only the value found at the end
+// of the path is converted back to an interface
+func walkPath(val reflect.Value, path []string, naming fieldNaming) (res interface{}, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("failed to access %s: %v", expr, r)
+			err = fmt.Errorf("%v", r)
 			res = nil
 		}
 	}()
 
-	value, ok := params[path[0]]
-	if !ok {
-		return nil, fmt.Errorf("no parameter " + path[0] + "found")
-	}
-
-	for i := 1; i < len(path); i++ {
-		val := reflect.ValueOf(value)
+	for i := 0; i < len(path); i++ {
+		if val.Kind() == reflect.Interface {
+			val = val.Elem()
+		}
 		if val.Kind() == reflect.Ptr {
 			val = val.Elem()
 		}
+		if !val.IsValid() {
+			// a nil pointer or interface, as the zero Value has no kind to report
+			return nil, newPathError(ErrTypeMismatch, path[:i+1], "nil value for selector %s", path[i])
+		}
 		switch val.Kind() {
 		case reflect.Struct:
-			v := val.FieldByName(path[i])
-			if v != (reflect.Value{}) {
-				value = v.Interface()
-				continue
+			v, ok, err := cachedFields(val.Type(), naming).field(val, path[i])
+			if err != nil {
+				return nil, err
 			}
+			if !ok {
+				return nil, newPathError(ErrUnknownParameter, path[:i+1], "no field %s found in %v", path[i], val.Type())
+			}
+			val = v
 		case reflect.Map:
 			v := val.MapIndex(reflect.ValueOf(path[i]))
-			if v != (reflect.Value{}) {
-				value = v.Interface()
-				continue
+			if v == (reflect.Value{}) {
+				return nil, newPathError(ErrUnknownParameter, path[:i+1], "no key %s found", path[i])
 			}
+			val = v
 		case reflect.Slice, reflect.Array:
 			idx, err := strconv.Atoi(path[i])
 			if err != nil {
-				return nil, fmt.Errorf("slice index must be int, not '%v'", path[i])
+				return nil, newPathError(ErrTypeMismatch, path[:i+1], "slice index must be int, not '%v'", path[i])
 			}
-			v := val.Index(idx)
-			if v != (reflect.Value{}) {
-				value = v.Interface()
-				continue
+			if idx < 0 || idx >= val.Len() {
+				return nil, newPathError(ErrIndexOutOfRange, path[:i+1], "index %d out of range with length %d", idx, val.Len())
 			}
+			val = val.Index(idx)
 		case reflect.String:
 			idx, err := strconv.Atoi(path[i])
 			if err != nil {
-				return nil, fmt.Errorf("string slice index must be int, not '%v'", path[i])
+				return nil, newPathError(ErrTypeMismatch, path[:i+1], "string slice index must be int, not '%v'", path[i])
 			}
-			v := val.String()
-			if v != "" {
-				value = []rune(v)[idx]
-				continue
+			runes := []rune(val.String())
+			if idx < 0 || idx >= len(runes) {
+				return nil, newPathError(ErrIndexOutOfRange, path[:i+1], "index %d out of range with length %d", idx, len(runes))
 			}
+			val = reflect.ValueOf(runes[idx])
 		default:
-			return nil, fmt.Errorf("invalid type %v for selector", val.Kind().String())
+			return nil, newPathError(ErrTypeMismatch, path[:i+1], "invalid type %v for selector", val.Kind().String())
+		}
+	}
+	if !val.IsValid() {
+		return nil, nil
+	}
+	return convert2Number(val.Interface()), nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// callMethod calls the exported method name of receiver, methods with a pointer receiver
+// are called on a copy when receiver is not a pointer, a non-nil error returned as the last value
+// of the method fails the call
+func callMethod(receiver interface{}, name string, args []interface{}) (res interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to call method %s: %v", name, r)
+			res = nil
+		}
+	}()
+
+	val := reflect.ValueOf(receiver)
+	if !val.IsValid() {
+		return nil, fmt.Errorf("cannot call method %s on nil", name)
+	}
+	method := val.MethodByName(name)
+	if !method.IsValid() && val.Kind() != reflect.Ptr {
+		ptr := reflect.New(val.Type())
+		ptr.Elem().Set(val)
+		method = ptr.MethodByName(name)
+	}
+	if !method.IsValid() {
+		return nil, fmt.Errorf("no method %s found for type %v", name, val.Type())
+	}
+
+	methodType := method.Type()
+	numIn := methodType.NumIn()
+	if methodType.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, fmt.Errorf("method %s expects at least %d arguments, got %d", name, numIn-1, len(args))
+		}
+	} else if len(args) != numIn {
+		return nil, fmt.Errorf("method %s expects %d arguments, got %d", name, numIn, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var argType reflect.Type
+		if methodType.IsVariadic() && i >= numIn-1 {
+			argType = methodType.In(numIn - 1).Elem()
+		} else {
+			argType = methodType.In(i)
+		}
+		in[i], err = convertArgument(arg, argType)
+		if err != nil {
+			e := err.(*Error)
+			e.Op = name
+			e.Msg = fmt.Sprintf("invalid argument %d of method %s: %s", i, name, e.Msg)
+			return nil, e
+		}
+	}
+
+	out := method.Call(in)
+	switch len(out) {
+	case 0:
+		return nil, nil
+	case 1:
+		if methodType.Out(0) == errorType {
+			if !out[0].IsNil() {
+				return nil, copyError(out[0].Interface().(error))
+			}
+			return nil, nil
+		}
+		return out[0].Interface(), nil
+	case 2:
+		if methodType.Out(1) != errorType {
+			return nil, fmt.Errorf("second value returned by method %s must be an error", name)
+		}
+		if !out[1].IsNil() {
+			return nil, copyError(out[1].Interface().(error))
 		}
+		return out[0].Interface(), nil
 	}
-	return convert2Float64(value), nil
+	return nil, fmt.Errorf("method %s returns too many values", name)
 }
 
-func convert2Float64(value interface{}) interface{} {
+// convertArgument converts a value of the expression to the type of a method parameter,
+// numbers are converted between numeric types as long as no fraction is lost
+func convertArgument(arg interface{}, argType reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		switch argType.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(argType), nil
+		}
+		return reflect.Value{}, newEvalError(ErrTypeMismatch, nil, []interface{}{nil}, "cannot use nil as %v", argType)
+	}
+
+	val := reflect.ValueOf(arg)
+	if val.Type().AssignableTo(argType) {
+		return val, nil
+	}
+	if isNumericKind(val.Kind()) && isNumericKind(argType.Kind()) {
+		if val.Kind() == reflect.Float64 && argType.Kind() != reflect.Float32 && argType.Kind() != reflect.Float64 &&
+			val.Float() != math.Trunc(val.Float()) {
+			return reflect.Value{}, newEvalError(ErrTypeMismatch, nil, []interface{}{arg}, "cannot use %v as %v", arg, argType)
+		}
+		if overflowsKind(val, argType) {
+			return reflect.Value{}, newEvalError(ErrTypeMismatch, nil, []interface{}{arg}, "cannot use %v as %v, it overflows", arg, argType)
+		}
+		return val.Convert(argType), nil
+	}
+	return reflect.Value{}, newEvalError(ErrTypeMismatch, nil, []interface{}{arg}, "cannot use %v as %v", arg, argType)
+}
+
+// overflowsKind reports whether the number val does not fit in the numeric type typ,
+// which reflect.Value.Convert would silently wrap, such as 300 as an int8 or -1 as a uint
+func overflowsKind(val reflect.Value, typ reflect.Type) bool {
+	target := reflect.Zero(typ)
+	switch {
+	case typ.Kind() >= reflect.Float32:
+		return val.Kind() >= reflect.Float32 && target.OverflowFloat(val.Float())
+	case typ.Kind() >= reflect.Uint:
+		switch {
+		case val.Kind() >= reflect.Float32:
+			// 1 << 64 is exactly representable as a float64
+			f := val.Float()
+			return f < 0 || f >= 1<<64 || target.OverflowUint(uint64(f))
+		case val.Kind() >= reflect.Uint:
+			return target.OverflowUint(val.Uint())
+		}
+		return val.Int() < 0 || target.OverflowUint(uint64(val.Int()))
+	}
+	switch {
+	case val.Kind() >= reflect.Float32:
+		f := val.Float()
+		return f < math.MinInt64 || f >= 1<<63 || target.OverflowInt(int64(f))
+	case val.Kind() >= reflect.Uint:
+		return val.Uint() > math.MaxInt64 || target.OverflowInt(int64(val.Uint()))
+	}
+	return target.OverflowInt(val.Int())
+}
+
+func isNumericKind(kind reflect.Kind) bool {
+	return reflect.Int <= kind && kind <= reflect.Float64
+}
+
+// convert2Number converts integers to int64 and floats to float64,
+// int32 and uint8 are kept as they are used for rune and byte,
+// uint64 values overflowing int64 are kept too, rather than losing precision
+func convert2Number(value interface{}) interface{} {
 	switch val := value.(type) {
 	case int:
-		return float64(val)
+		return int64(val)
 	case int8:
-		return float64(val)
+		return int64(val)
 	case int16:
-		return float64(val)
+		return int64(val)
 	// case int32: //rune is int32,
-	// 	return float64(val)
-	case int64:
-		return float64(val)
+	// 	return int64(val)
 	case float32:
 		return float64(val)
 	case uint:
-		return float64(val)
+		if uint64(val) <= math.MaxInt64 {
+			return int64(val)
+		}
 	case uint16:
-		return float64(val)
+		return int64(val)
 	case uint32:
-		return float64(val)
+		return int64(val)
 	case uint64:
-		return float64(val)
-	default:
-		return value
+		if val <= math.MaxInt64 {
+			return int64(val)
+		}
 	}
+	return value
 }
@@ -0,0 +1,90 @@
+package goexpr
+
+import "strings"
+
+// Wildcard is the segment of a path returned by Paths which is only known once evaluated,
+// such as the index of a[i]
+const Wildcard = "*"
+
+// Variables returns the names of the parameters read by the expression, in the order they first appear
+func (expr *Expr) Variables() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, path := range expr.Paths() {
+		if !seen[path[0]] {
+			seen[path[0]] = true
+			names = append(names, path[0])
+		}
+	}
+	return names
+}
+
+// Paths returns the paths of the parameters read by the expression, in the order they first appear,
+// such as [user address city] for user.address.city and [items 0 name] for items[0].name.
+// a segment only known once evaluated is Wildcard: [items * name] for items[i].name.
+// the parameters of branches removed by the optimization are not reported, such as x of false && x
+func (expr *Expr) Paths() [][]string {
+	var paths [][]string
+	seen := map[string]bool{}
+	collectPaths(expr.astNode, func(path []string) {
+		key := strings.Join(path, "\x00")
+		if !seen[key] {
+			seen[key] = true
+			paths = append(paths, path)
+		}
+	})
+	return paths
+}
+
+// collectPaths calls add with the path of every parameter read by the tree from node
+func collectPaths(node *astNode, add func(path []string)) {
+	if node == nil || node.constant {
+		return
+	}
+	if path, dynamic, ok := paramPath(node); ok {
+		add(path)
+		for _, seg := range dynamic {
+			collectPaths(seg, add)
+		}
+		return
+	}
+
+	collectPaths(node.left, add)
+	collectPaths(node.right, add)
+	for _, r := range node.rightList {
+		collectPaths(r, add)
+	}
+}
+
+// paramPath returns the path of the parameter read by node, along with the segments of the path
+// which are only known once evaluated. it is false when node is not a parameter,
+// such as the result of a method followed by segments
+func paramPath(node *astNode) (path []string, dynamic []*astNode, ok bool) {
+	switch node.operator {
+	case VARIABLE, SELECTOR:
+		path = append([]string{}, node.path...)
+	case OPTIONAL:
+		if path, dynamic, ok = paramPath(node.left); !ok {
+			return nil, nil, false
+		}
+	default:
+		return nil, nil, false
+	}
+
+	for _, seg := range node.rightList {
+		switch {
+		case seg.operator == ACCESSOR:
+			path = append(path, seg.path...)
+		case seg.constant:
+			key, ok := constantKey(seg.value)
+			if !ok {
+				key = Wildcard
+			}
+			path = append(path, key)
+		default:
+			path = append(path, Wildcard)
+			dynamic = append(dynamic, seg)
+		}
+	}
+	return path, dynamic, true
+}
@@ -0,0 +1,94 @@
+package goexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	tests := []struct {
+		input     string
+		paths     [][]string
+		variables []string
+	}{
+		{
+			input:     "a",
+			paths:     [][]string{{"a"}},
+			variables: []string{"a"},
+		},
+		{
+			input:     "user.address.city == city && user.age > 18",
+			paths:     [][]string{{"user", "address", "city"}, {"city"}, {"user", "age"}},
+			variables: []string{"user", "city"},
+		},
+		{
+			input:     `items[0].name + items["1"].name + items[0].name`,
+			paths:     [][]string{{"items", "0", "name"}, {"items", "1", "name"}},
+			variables: []string{"items"},
+		},
+		{
+			input:     "param.Array[param.int64].x",
+			paths:     [][]string{{"param", "Array", "*", "x"}, {"param", "int64"}},
+			variables: []string{"param"},
+		},
+		{
+			input:     "m[k[i]]",
+			paths:     [][]string{{"m", "*"}, {"k", "*"}, {"i"}},
+			variables: []string{"m", "k", "i"},
+		},
+		{
+			input:     "a?.b.c[0] ?? d",
+			paths:     [][]string{{"a", "b", "c", "0"}, {"d"}},
+			variables: []string{"a", "d"},
+		},
+		{
+			input:     "user.Orders(limit)[0].Total > min",
+			paths:     [][]string{{"user"}, {"limit"}, {"min"}},
+			variables: []string{"user", "limit", "min"},
+		},
+		{
+			input:     "x in [a, b.c] ? f(y) : -z",
+			paths:     [][]string{{"x"}, {"a"}, {"b", "c"}, {"y"}, {"z"}},
+			variables: []string{"x", "a", "b", "y", "z"},
+		},
+		{
+			input:     "false && x || y",
+			paths:     [][]string{{"y"}},
+			variables: []string{"y"},
+		},
+		{
+			input: "1 + 2",
+		},
+		{
+			input: "",
+		},
+	}
+
+	functions := map[string]ExprFunc{
+		"f": func(args ...interface{}) (interface{}, error) { return args[0], nil },
+	}
+	for _, test := range tests {
+		expr, err := NewExprWithFunctions(test.input, functions)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		if paths := expr.Paths(); !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("input %s: paths %q do not match wanted: %q", test.input, paths, test.paths)
+		}
+		if variables := expr.Variables(); !reflect.DeepEqual(variables, test.variables) {
+			t.Errorf("input %s: variables %q do not match wanted: %q", test.input, variables, test.variables)
+		}
+	}
+}
+
+func TestPathsNotShared(t *testing.T) {
+	expr, err := NewExpr("a.b.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr.Paths()[0][0] = "x"
+	if res, err := expr.Eval(map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": 1}}}); err != nil || res != int64(1) {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+}
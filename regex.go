@@ -0,0 +1,98 @@
+package goexpr
+
+import (
+	"regexp"
+	"sync"
+)
+
+// maxCachedPatterns bounds the number of dynamic patterns kept compiled,
+// the cache is emptied when it is full
+const maxCachedPatterns = 256
+
+// patternCache keeps the patterns compiled during evaluation,
+// patterns written as literal strings are compiled once at parse time instead
+type patternCache struct {
+	mu       sync.RWMutex
+	patterns map[string]*regexp.Regexp
+}
+
+var dynamicPatterns = &patternCache{
+	patterns: make(map[string]*regexp.Regexp),
+}
+
+func (c *patternCache) compile(pattern string) (*regexp.Regexp, error) {
+	c.mu.RLock()
+	re, ok := c.patterns[pattern]
+	c.mu.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if len(c.patterns) >= maxCachedPatterns {
+		c.patterns = make(map[string]*regexp.Regexp)
+	}
+	c.patterns[pattern] = re
+	c.mu.Unlock()
+	return re, nil
+}
+
+// compileConstantPattern compiles the pattern of a match node once for all
+// when it is a literal string, an invalid pattern is reported as a syntax error
+func compileConstantPattern(node *astNode) error {
+	pattern, ok := node.right.value.(string)
+	if !node.right.constant || !ok {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		e := newSyntaxError(node.right.pos, node.right.end, "invalid regular expression %q: %v", pattern, err)
+		e.Err = err
+		return e
+	}
+	if node.operator == MATCH {
+		node.calculator = calculatorMATCH(re)
+	} else {
+		node.calculator = calculatorNOTMATCH(re)
+	}
+	return nil
+}
+
+// calculatorMATCH matches left against the pattern re,
+// or against the pattern in right when re is nil
+func calculatorMATCH(re *regexp.Regexp) calculator {
+	return func(left, right interface{}, ctx evalContext) (interface{}, error) {
+		matched, err := matchPattern(re, MATCH, left, right)
+		if err != nil {
+			return nil, err
+		}
+		return convertBool2Interface(matched), nil
+	}
+}
+
+func calculatorNOTMATCH(re *regexp.Regexp) calculator {
+	return func(left, right interface{}, ctx evalContext) (interface{}, error) {
+		matched, err := matchPattern(re, NOT_MATCH, left, right)
+		if err != nil {
+			return nil, err
+		}
+		return convertBool2Interface(!matched), nil
+	}
+}
+
+func matchPattern(re *regexp.Regexp, op TokenType, left, right interface{}) (bool, error) {
+	if re == nil {
+		var err error
+		re, err = dynamicPatterns.compile(right.(string))
+		if err != nil {
+			e := newEvalError(nil, op, []interface{}{left, right}, "invalid regular expression %q: %v", right, err)
+			e.Err = err
+			return false, e
+		}
+	}
+	return re.MatchString(left.(string)), nil
+}
@@ -1,20 +1,35 @@
 package goexpr
 
+import "unicode"
+
 type runeStream struct {
-	runes []rune
-	pos   int
-	len   int
+	runes     []rune
+	positions []Position // position of each rune, followed by the end of input
+	pos       int
+	len       int
 }
 
 func newRuneStream(expr string) *runeStream {
-	var runes []rune
-	for _, r := range expr {
+	var (
+		runes     []rune
+		positions []Position
+	)
+	line, column := 1, 1
+	for offset, r := range expr {
 		runes = append(runes, r)
+		positions = append(positions, Position{Offset: offset, Line: line, Column: column})
+		if r == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
 	}
+	positions = append(positions, Position{Offset: len(expr), Line: line, Column: column})
 	return &runeStream{
-		runes: runes,
-		pos:   0,
-		len:   len(runes),
+		runes:     runes,
+		positions: positions,
+		pos:       0,
+		len:       len(runes),
 	}
 }
 
@@ -28,6 +43,51 @@ func (rs *runeStream) flowBackward(step int) {
 	rs.pos -= step
 }
 
+// peekNonSpace returns the next non-space rune without moving forward,
+// or 0 if there is none left
+func (rs *runeStream) peekNonSpace() rune {
+	for i := rs.pos; i < rs.len; i++ {
+		if !unicode.IsSpace(rs.runes[i]) {
+			return rs.runes[i]
+		}
+	}
+	return 0
+}
+
+// skipWord moves forward over the spaces and the word following them,
+// it does not move if the following word is not the given one
+func (rs *runeStream) skipWord(word string) bool {
+	i := rs.pos
+	for i < rs.len && unicode.IsSpace(rs.runes[i]) {
+		i++
+	}
+	for _, r := range word {
+		if i >= rs.len || rs.runes[i] != r {
+			return false
+		}
+		i++
+	}
+	if i < rs.len && isVariable(rs.runes[i]) {
+		return false
+	}
+	rs.pos = i
+	return true
+}
+
+// position returns the position of the next rune
+func (rs *runeStream) position() Position {
+	return rs.positions[rs.pos]
+}
+
+// tokenEnd returns the position following the last non-space rune read
+func (rs *runeStream) tokenEnd() Position {
+	i := rs.pos
+	for i > 0 && unicode.IsSpace(rs.runes[i-1]) {
+		i--
+	}
+	return rs.positions[i]
+}
+
 func (rs *runeStream) notEOF() bool {
 	return rs.pos < rs.len
 }
@@ -0,0 +1,394 @@
+package goexpr
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// NewExprWithSchema parses the expression like NewExpr, and checks it against schema, the type of its parameters:
+// a struct type declared by StructOf, or the type of a sample struct or map given to TypeOf.
+// it fails with an error matching ErrUnknownParameter when a parameter is not declared by schema,
+// and ErrTypeMismatch when an operator is given operands of the wrong type.
+// the type of the values of the expression is then given by Type
+func NewExprWithSchema(expr string, schema *Type, opts ...Option) (*Expr, error) {
+	if schema == nil || schema.kind != KindStruct {
+		return nil, withInput(newEvalError(ErrTypeMismatch, nil, nil, "schema must be a struct type, not %v", schema), expr)
+	}
+	return NewExprWithFunctions(expr, nil, append(opts, withSchema(schema))...)
+}
+
+func withSchema(schema *Type) Option {
+	return func(o *options) {
+		o.schema = schema
+	}
+}
+
+// Type returns the type of the values of the expression inferred from its schema,
+// it is AnyType when the expression has no schema
+func (expr *Expr) Type() *Type {
+	if expr.typ == nil {
+		return AnyType
+	}
+	return expr.typ
+}
+
+// typeChecker infers the type of every node from the types of the parameters,
+// values of any type are only checked once evaluated, as they are without schema
+type typeChecker struct {
+	schema *Type
+	fields fieldNaming
+}
+
+// checkTypes sets the type of every node of the tree from root, and returns the type of root
+func checkTypes(root *astNode, schema *Type, naming fieldNaming) (*Type, error) {
+	if root == nil {
+		return NilType, nil
+	}
+	c := &typeChecker{schema: schema, fields: naming}
+	return c.check(root)
+}
+
+func (c *typeChecker) check(node *astNode) (*Type, error) {
+	t, err := c.infer(node)
+	if err != nil {
+		return nil, wrapError(err, node.pos, node.end)
+	}
+	node.typ = t
+	return t, nil
+}
+
+func (c *typeChecker) infer(node *astNode) (*Type, error) {
+	if node.constant {
+		if node.value == nil {
+			return NilType, nil
+		}
+		return TypeOf(node.value), nil
+	}
+
+	switch node.operator {
+	case VARIABLE, SELECTOR:
+		var (
+			t   = c.schema
+			err error
+		)
+		for i, part := range node.path {
+			if t, err = c.index(t, part, node.path[:i+1]); err != nil {
+				return nil, err
+			}
+		}
+		return c.segments(t, node.path, node.rightList)
+	case LITERAL, OPTIONAL:
+		// path segments following a function, a method or ?.
+		left, err := c.check(node.left)
+		if err != nil {
+			return nil, err
+		}
+		return c.segments(left, nil, node.rightList)
+	case FUNC:
+		return c.call(node)
+	case ARRAY:
+		elem := AnyType
+		for i, r := range node.rightList {
+			t, err := c.check(r)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				elem = t
+			} else {
+				elem = joinTypes(elem, t)
+			}
+		}
+		return ArrayOf(elem), nil
+	case CLAUSE:
+		return c.check(node.right)
+	}
+
+	if node.left == nil {
+		right, err := c.check(node.right)
+		if err != nil {
+			return nil, err
+		}
+		return c.prefix(node, right)
+	}
+	left, err := c.check(node.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.check(node.right)
+	if err != nil {
+		return nil, err
+	}
+	return c.binary(node, left, right)
+}
+
+func (c *typeChecker) prefix(node *astNode, right *Type) (*Type, error) {
+	switch node.operator {
+	case NOT:
+		if !right.isBool() {
+			return nil, mismatch(node, node.right, right, "it is not a bool")
+		}
+		return BoolType, nil
+	case NEG:
+		if !right.isNumber() {
+			return nil, mismatch(node, node.right, right, "it is not a number")
+		}
+		return right, nil
+	}
+	return AnyType, nil
+}
+
+func (c *typeChecker) binary(node *astNode, left, right *Type) (*Type, error) {
+	switch node.operator {
+	case ADD:
+		switch {
+		case left.kind == KindString || right.kind == KindString:
+			return StringType, nil
+		case left.isNumber() && right.isNumber():
+			return numberType(left, right), nil
+		case left.kind == KindAny || right.kind == KindAny:
+			// the other operand can only be concatenated to a string
+			return StringType, nil
+		case !left.isNumber():
+			return nil, mismatch(node, node.left, left, "it is neither a number nor a string")
+		}
+		return nil, mismatch(node, node.right, right, "it is neither a number nor a string")
+	case SUB, MUL, QUO, REM:
+		if err := expect(node, left, right, (*Type).isNumber, "it is not a number"); err != nil {
+			return nil, err
+		}
+		return numberType(left, right), nil
+	case AND, OR, XOR, SHL, SHR:
+		if err := expect(node, left, right, (*Type).isNumber, "it is not an integer"); err != nil {
+			return nil, err
+		}
+		return IntType, nil
+	case GT, LT, GEQ, LEQ:
+		if !left.isNumber() && !left.isString() {
+			return nil, mismatch(node, node.left, left, "it is neither a number nor a string")
+		}
+		if !(left.isNumber() && right.isNumber()) && !(left.isString() && right.isString()) {
+			return nil, mismatch(node, node.right, right, fmt.Sprintf("it cannot be compared with %v", left))
+		}
+		return BoolType, nil
+	case MATCH, NOT_MATCH:
+		if err := expect(node, left, right, (*Type).isString, "it is not a string"); err != nil {
+			return nil, err
+		}
+		return BoolType, nil
+	case LAND, LOR:
+		if err := expect(node, left, right, (*Type).isBool, "it is not a bool"); err != nil {
+			return nil, err
+		}
+		return BoolType, nil
+	case IN, NOT_IN:
+		switch right.kind {
+		case KindArray, KindMap, KindAny:
+		case KindStruct:
+			if right.goType != nil {
+				return nil, mismatch(node, node.right, right, "it is not an array, a slice or a map")
+			}
+		default:
+			return nil, mismatch(node, node.right, right, "it is not an array, a slice or a map")
+		}
+		return BoolType, nil
+	case EQ, NEQ:
+		return BoolType, nil
+	case TERNARY_IF:
+		if !left.isBool() {
+			return nil, mismatch(node, node.left, left, "it is not a bool")
+		}
+		// the value is nil when the condition is false and there is no else branch
+		return right, nil
+	case COALESCE, TERNARY_ELSE:
+		return joinTypes(left, right), nil
+	}
+	return AnyType, nil
+}
+
+// numberType returns the type of the result of an arithmetic operator on left and right,
+// integers are promoted to float as soon as one of the operands is a float
+func numberType(left, right *Type) *Type {
+	switch {
+	case left.kind == KindInt && right.kind == KindInt:
+		return IntType
+	case left.kind == KindFloat || right.kind == KindFloat:
+		return FloatType
+	}
+	return AnyType
+}
+
+// expect checks that both operands of node are accepted by ok
+func expect(node *astNode, left, right *Type, ok func(*Type) bool, reason string) error {
+	if !ok(left) {
+		return mismatch(node, node.left, left, reason)
+	}
+	if !ok(right) {
+		return mismatch(node, node.right, right, reason)
+	}
+	return nil
+}
+
+// mismatch reports the operand of node whose type t is not accepted by the operator of node
+func mismatch(node, operand *astNode, t *Type, reason string) error {
+	err := newEvalError(ErrTypeMismatch, node.operator, nil, "value of type %v cannot be used with the operator '%v', %s", t, node.operator, reason)
+	return wrapError(err, operand.pos, operand.end)
+}
+
+// segments returns the type of the value reached by the path segments rightList from a value of type t,
+// path is the path of t, if any, which is reported by errors
+func (c *typeChecker) segments(t *Type, path []string, rightList []*astNode) (*Type, error) {
+	for _, seg := range rightList {
+		if seg.operator == ACCESSOR {
+			for _, part := range seg.path {
+				path = append(path[:len(path):len(path)], part)
+				var err error
+				if t, err = c.index(t, part, path); err != nil {
+					return nil, wrapError(err, seg.pos, seg.end)
+				}
+			}
+			seg.typ = t
+			continue
+		}
+
+		key, err := c.check(seg)
+		if err != nil {
+			return nil, err
+		}
+		if seg.constant {
+			part, ok := constantKey(seg.value)
+			if !ok {
+				return nil, wrapError(newPathError(ErrTypeMismatch, path, "invalid index %v", seg.value), seg.pos, seg.end)
+			}
+			path = append(path[:len(path):len(path)], part)
+			if t, err = c.index(t, part, path); err != nil {
+				return nil, wrapError(err, seg.pos, seg.end)
+			}
+			continue
+		}
+
+		// the key is only known once evaluated
+		path = append(path[:len(path):len(path)], "*")
+		switch t.kind {
+		case KindArray, KindString:
+			if !key.isNumber() {
+				return nil, wrapError(newPathError(ErrTypeMismatch, path, "index of %v must be an integer, not %v", t, key), seg.pos, seg.end)
+			}
+			if t.kind == KindString {
+				t = CharType
+			} else {
+				t = t.elem
+			}
+		case KindMap:
+			t = t.elem
+		case KindStruct, KindAny:
+			t = AnyType
+		default:
+			return nil, wrapError(newPathError(ErrTypeMismatch, path, "value of type %v cannot be indexed", t), seg.pos, seg.end)
+		}
+	}
+	return t, nil
+}
+
+// constantKey returns the part of a path given by a constant index, as buildPathFromRight does
+func constantKey(value interface{}) (string, bool) {
+	switch key := value.(type) {
+	case int64:
+		return strconv.FormatInt(key, 10), true
+	case float64:
+		return floatKey(key)
+	case string:
+		return key, true
+	}
+	return "", false
+}
+
+// index returns the type of the field, the key or the element named key of t, path is the path of the field
+func (c *typeChecker) index(t *Type, key string, path []string) (*Type, error) {
+	switch t.kind {
+	case KindStruct, KindMap, KindAny:
+		if field, ok := t.field(key, c.fields); ok {
+			return field, nil
+		}
+		if t == c.schema {
+			return nil, newPathError(ErrUnknownParameter, path, "unknown parameter %s", key)
+		}
+		return nil, newPathError(ErrUnknownParameter, path, "no field %s found in %v of %s", key, t, strings.Join(path, "."))
+	case KindArray, KindString:
+		if _, err := strconv.Atoi(key); err != nil {
+			return nil, newPathError(ErrTypeMismatch, path, "index of %v must be an integer, not '%s'", t, key)
+		}
+		if t.kind == KindString {
+			return CharType, nil
+		}
+		return t.elem, nil
+	}
+	return nil, newPathError(ErrTypeMismatch, path, "value of type %v has no field %s", t, key)
+}
+
+// call returns the type of the value returned by a function or a method,
+// functions return values of any type
+func (c *typeChecker) call(node *astNode) (*Type, error) {
+	args := make([]*Type, len(node.rightList))
+	for i, r := range node.rightList {
+		t, err := c.check(r)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = t
+	}
+	if node.left == nil {
+		return AnyType, nil
+	}
+
+	receiver, err := c.check(node.left)
+	if err != nil {
+		return nil, err
+	}
+	method, ok := receiver.method(node.name)
+	if !ok {
+		if receiver.kind == KindAny && receiver.goType == nil {
+			return AnyType, nil
+		}
+		return nil, newEvalError(ErrTypeMismatch, node.name, nil, "no method %s found for type %v", node.name, receiver)
+	}
+
+	numIn := method.NumIn()
+	if method.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, newEvalError(ErrTypeMismatch, node.name, nil, "method %s expects at least %d arguments, got %d", node.name, numIn-1, len(args))
+		}
+	} else if len(args) != numIn {
+		return nil, newEvalError(ErrTypeMismatch, node.name, nil, "method %s expects %d arguments, got %d", node.name, numIn, len(args))
+	}
+	for i, arg := range args {
+		var argType reflect.Type
+		if method.IsVariadic() && i >= numIn-1 {
+			argType = method.In(numIn - 1).Elem()
+		} else {
+			argType = method.In(i)
+		}
+		if !arg.assignableTo(argType) {
+			err := newEvalError(ErrTypeMismatch, node.name, nil, "invalid argument %d of method %s: cannot use value of type %v as %v", i, node.name, arg, argType)
+			return nil, wrapError(err, node.rightList[i].pos, node.rightList[i].end)
+		}
+	}
+
+	switch method.NumOut() {
+	case 0:
+		return NilType, nil
+	case 1:
+		if method.Out(0) == errorType {
+			return NilType, nil
+		}
+		return typeFor(method.Out(0)), nil
+	case 2:
+		if method.Out(1) != errorType {
+			return nil, newEvalError(ErrTypeMismatch, node.name, nil, "second value returned by method %s must be an error", node.name)
+		}
+		return typeFor(method.Out(0)), nil
+	}
+	return nil, newEvalError(ErrTypeMismatch, node.name, nil, "method %s returns too many values", node.name)
+}
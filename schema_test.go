@@ -0,0 +1,257 @@
+package goexpr
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaTypes(t *testing.T) {
+	schema := TypeOf(testOrder{})
+	tests := []struct {
+		input  string
+		wanted string
+	}{
+		{"Total * 2", "float"},
+		{"ID + 1", "int"},
+		{"ID / 2 + Total", "float"},
+		{"-ID", "int"},
+		{"Items[0]", "string"},
+		{"Items[ID]", "string"},
+		{"Items", "[]string"},
+		{"Name[0]", "char"},
+		{"Customer.First + ' ' + Customer.Last", "string"},
+		{"Customer.FullName()", "string"},
+		{"Customer.IsAdult() && Paid", "bool"},
+		{"Customer.BestFriend().Age", "int"},
+		{"Customer.Friends[0].AgeIn(2) > 18", "bool"},
+		{"Customer.Join(\", \", \"a\", \"b\")", "string"},
+		{"Customer", "goexpr.testUser"},
+		{"Profile.Tags.any", "string"},
+		{"Profile.Address?.City", "string"},
+		{"Paid ? Total : 0.5", "float"},
+		{"Paid ? Total : 0", "any"},
+		{"Paid ? Items : nil", "[]string"},
+		{"Paid ? Total", "float"},
+		{"Profile.Address?.City ?? \"Paris\"", "string"},
+		{"Name =~ `^o` || \"book\" in Items", "bool"},
+		{"[ID, 2]", "[]int"},
+		{"[ID, Name]", "[]any"},
+		{"ID & 1 << 2", "int"},
+		{"(ID)", "int"},
+		{"", "nil"},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExprWithSchema(test.input, schema)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		if typ := expr.Type().String(); typ != test.wanted {
+			t.Errorf("input %s: type %s does not match wanted: %s", test.input, typ, test.wanted)
+		}
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	schema := TypeOf(testOrder{})
+	tests := []struct {
+		input  string
+		wanted error
+		pos    int // column where the error starts
+		path   []string
+	}{
+		{"Name - 1", ErrTypeMismatch, 1, nil},
+		{"1 * Paid", ErrTypeMismatch, 5, nil},
+		{"Total > \"a\"", ErrTypeMismatch, 9, nil},
+		{"Paid + 1", ErrTypeMismatch, 1, nil},
+		{"!Total", ErrTypeMismatch, 2, nil},
+		{"-Name", ErrTypeMismatch, 2, nil},
+		{"Paid && ID", ErrTypeMismatch, 9, nil},
+		{"Name | 1", ErrTypeMismatch, 1, nil},
+		{"Name =~ ID", ErrTypeMismatch, 9, nil},
+		{"\"a\" in Total", ErrTypeMismatch, 8, nil},
+		{"ID ? 1 : 2", ErrTypeMismatch, 1, nil},
+		{"Totl > 1", ErrUnknownParameter, 1, []string{"Totl"}},
+		{"Paid || Customer.Frist == \"Bob\"", ErrUnknownParameter, 9, []string{"Customer", "Frist"}},
+		{"Customer.Friends[0].Nme", ErrUnknownParameter, 20, []string{"Customer", "Friends", "0", "Nme"}},
+		{"Name.First", ErrTypeMismatch, 1, []string{"Name", "First"}},
+		{"Items[\"a\"]", ErrTypeMismatch, 7, []string{"Items", "a"}},
+		{"Items[1.5]", ErrTypeMismatch, 7, []string{"Items"}},
+		{"Items[Name]", ErrTypeMismatch, 7, []string{"Items", "*"}},
+		{"Items[Paid]", ErrTypeMismatch, 7, []string{"Items", "*"}},
+		{"Customer.Greet(1)", ErrTypeMismatch, 16, nil},
+		{"Customer.Greet()", ErrTypeMismatch, 1, nil},
+		{"Customer.Fly()", ErrTypeMismatch, 1, nil},
+		{"Total.Round()", ErrTypeMismatch, 1, nil},
+		{"(Paid ? Name : Customer.First) - 1", ErrTypeMismatch, 1, nil},
+	}
+
+	for _, test := range tests {
+		_, err := NewExprWithSchema(test.input, schema)
+		if !errors.Is(err, test.wanted) {
+			t.Errorf("input %s: error %v should be %v", test.input, err, test.wanted)
+			continue
+		}
+		var exprErr *Error
+		if !errors.As(err, &exprErr) {
+			t.Errorf("input %s: error %v should be an *Error", test.input, err)
+			continue
+		}
+		if exprErr.Pos.Column != test.pos || exprErr.Input != test.input {
+			t.Errorf("input %s: error %v should start at column %d", test.input, err, test.pos)
+		}
+		if test.path != nil && !reflect.DeepEqual(exprErr.Path, test.path) {
+			t.Errorf("input %s: error path %v does not match wanted: %v", test.input, exprErr.Path, test.path)
+		}
+	}
+}
+
+func TestSchemaSample(t *testing.T) {
+	sample := map[string]interface{}{
+		"user": map[string]interface{}{
+			"age":  30,
+			"tags": []interface{}{"a", "b"},
+		},
+		"limit": 2.5,
+		"extra": nil,
+	}
+	tests := []struct {
+		input  string
+		wanted string
+		err    error
+	}{
+		{input: "user.age > limit", wanted: "bool"},
+		{input: "user.tags[0] + 1", wanted: "string"},
+		{input: "user.tags[1.0] + 1", wanted: "string"},
+		{input: "user[\"age\"] * 2", wanted: "int"},
+		{input: "extra.anything", wanted: "any"},
+		{input: "user.agee > 1", err: ErrUnknownParameter},
+		{input: "user.tags - 1", err: ErrTypeMismatch},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExprWithSchema(test.input, TypeOf(sample))
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("input %s: error %v should be %v", test.input, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		if typ := expr.Type().String(); typ != test.wanted {
+			t.Errorf("input %s: type %s does not match wanted: %s", test.input, typ, test.wanted)
+		}
+	}
+}
+
+func TestSchemaDeclared(t *testing.T) {
+	schema := StructOf(map[string]*Type{
+		"score":  FloatType,
+		"labels": MapOf(StringType),
+		"events": ArrayOf(StructOf(map[string]*Type{"name": StringType, "at": IntType})),
+	})
+	if s := schema.String(); s != "{events []{at int; name string}; labels map[string]; score float}" {
+		t.Errorf("schema is printed as %s", s)
+	}
+
+	expr, err := NewExprWithSchema(`score > 0.5 && labels.env == "prod" && events[0].at > 10`, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.Type() != BoolType {
+		t.Errorf("type %v should be bool", expr.Type())
+	}
+	params := map[string]interface{}{
+		"score":  0.7,
+		"labels": map[string]string{"env": "prod"},
+		"events": []interface{}{map[string]interface{}{"name": "login", "at": 12}},
+	}
+	if res, err := expr.Eval(params); err != nil || res != true {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+
+	if _, err = NewExprWithSchema("events[0].name - 1", schema); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("error %v should be a type mismatch", err)
+	}
+	if _, err = NewExprWithSchema("score", nil); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("nil schema should fail, got %v", err)
+	}
+	if _, err = NewExprWithSchema("score", IntType); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("int schema should fail, got %v", err)
+	}
+}
+
+func TestSchemaOptions(t *testing.T) {
+	payload := &testPayload{UserID: 42, Address: &testAddress{City: "Paris"}}
+
+	expr, err := NewExprWithSchema("user_id + 1", TypeOf(payload), WithFieldTag("json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.Type() != IntType {
+		t.Errorf("type %v should be int", expr.Type())
+	}
+	if res, err := expr.EvalStruct(payload); err != nil || res != int64(43) {
+		t.Errorf("result '%v', error %v", res, err)
+	}
+	if _, err = NewExprWithSchema("Token", TypeOf(payload), WithFieldTag("json")); !errors.Is(err, ErrUnknownParameter) {
+		t.Errorf("hidden field should be unknown, got %v", err)
+	}
+	if _, err = NewExprWithSchema("address.city", TypeOf(payload), WithFieldTag("json"), WithCaseInsensitiveFields()); err != nil {
+		t.Errorf("field should be found regardless of its case, got %v", err)
+	}
+
+	max := func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		return args[0], nil
+	}
+	expr, err = NewExprWithSchema("max(UserID, 2) * 2", TypeOf(payload), WithContextFunctions(map[string]ExprContextFunc{"max": max}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.Type() != AnyType {
+		t.Errorf("type %v of a function call should be any", expr.Type())
+	}
+
+	expr, err = NewExpr("1 + 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.Type() != AnyType {
+		t.Errorf("type %v without schema should be any", expr.Type())
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	type named string
+	tests := []struct {
+		value  interface{}
+		wanted string
+	}{
+		{nil, "any"},
+		{int8(1), "int"},
+		{uint(1), "int"},
+		{float32(1), "float"},
+		{'a', "char"},
+		{byte(1), "uint8"},
+		{named("a"), "goexpr.named"},
+		{[]int{1}, "[]int"},
+		{[]interface{}{1, 2.5}, "[]any"},
+		{[]interface{}{"a", nil}, "[]any"},
+		{map[string]int{"a": 1}, "{a int}"},
+		{map[int]string{}, "map[string]"},
+		{&testAddress{}, "goexpr.testAddress"},
+		{(*testAddress)(nil), "goexpr.testAddress"},
+	}
+
+	for _, test := range tests {
+		if typ := TypeOf(test.value).String(); typ != test.wanted {
+			t.Errorf("type of %#v is %s, wanted %s", test.value, typ, test.wanted)
+		}
+	}
+}
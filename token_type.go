@@ -10,11 +10,13 @@ const (
 	// literal operators
 	CHAR     // 'a', '爱', ...
 	STRING   // "abc"
-	NUMBER   // 123, 123.456 treated as float64
+	NUMBER   // 123 treated as int64, 123.456 treated as float64
 	BOOL     // true, false
+	NIL      // nil
 	VARIABLE // a1, b_2, c
 	SELECTOR // a.b.c,
 	ACCESSOR // .a.b
+	OPTIONAL // ?. of optional chaining, a?.b
 
 	// prefix operators
 	NOT // !
@@ -41,6 +43,9 @@ const (
 	LAND // &&
 	LOR  // ||
 
+	// null-coalescing operator
+	COALESCE // ??
+
 	// comparer operators
 	EQ  // ==
 	NEQ // !=
@@ -49,6 +54,13 @@ const (
 	LEQ // <=
 	GEQ // >=
 
+	MATCH     // =~
+	NOT_MATCH // !~
+
+	// membership operators
+	IN     // in
+	NOT_IN // not in
+
 	// clause operators
 	LPAREN // (
 	RPAREN // )
@@ -56,7 +68,10 @@ const (
 	LBRACKET // [
 	RBRACKET // ]
 
-	FUNC // represent function
+	COMMA // ,
+
+	FUNC  // represent function
+	ARRAY // represent array literals, [1, 2, 3]
 
 	LITERAL // represent all literal operators
 	CLAUSE  // represent all clause operators
@@ -69,11 +84,13 @@ var tokens = [...]string{
 	VARIABLE: "VARIABLE",
 	SELECTOR: "SELECTOR",
 	ACCESSOR: "ACCESSOR",
+	OPTIONAL: "?.",
 
 	CHAR:   "CHAR",
 	STRING: "STRING",
 	NUMBER: "NUMBER",
 	BOOL:   "BOOL",
+	NIL:    "nil",
 
 	NOT: "!",
 	NEG: "-",
@@ -93,6 +110,8 @@ var tokens = [...]string{
 	LAND: "&&",
 	LOR:  "||",
 
+	COALESCE: "??",
+
 	EQ:  "==",
 	NEQ: "!=",
 	LT:  "<",
@@ -100,6 +119,12 @@ var tokens = [...]string{
 	LEQ: "<=",
 	GEQ: ">=",
 
+	MATCH:     "=~",
+	NOT_MATCH: "!~",
+
+	IN:     "in",
+	NOT_IN: "not in",
+
 	TERNARY_IF:   "?",
 	TERNARY_ELSE: ":",
 
@@ -109,7 +134,10 @@ var tokens = [...]string{
 	LBRACKET: "LBRACKET",
 	RBRACKET: "RBRACKET",
 
-	FUNC: "FUNC",
+	COMMA: ",",
+
+	FUNC:  "FUNC",
+	ARRAY: "ARRAY",
 
 	LITERAL: "LITERAL",
 	CLAUSE:  "CLAUSE",
@@ -132,10 +160,12 @@ type opPriority int
 const (
 	priorityUNKNOWN opPriority = iota
 	priorityTENARY
+	priorityCOALESCE
 	priorityLOR
 	priorityLAND
 	priorityBIT
 	priorityCOMPARER
+	priorityMEMBERSHIP
 	priorityBITSHIFT
 	priorityADD
 	priorityMUL
@@ -148,12 +178,16 @@ func (op TokenType) Priority() opPriority {
 	switch op {
 	case TERNARY_IF, TERNARY_ELSE:
 		return priorityTENARY
+	case COALESCE:
+		return priorityCOALESCE
 	case LOR:
 		return priorityLOR
 	case LAND:
 		return priorityLAND
-	case EQ, NEQ, GT, LT, GEQ, LEQ:
+	case EQ, NEQ, GT, LT, GEQ, LEQ, MATCH, NOT_MATCH:
 		return priorityCOMPARER
+	case IN, NOT_IN:
+		return priorityMEMBERSHIP
 	case SHL, SHR:
 		return priorityBITSHIFT
 	case AND, OR, XOR:
@@ -166,7 +200,7 @@ func (op TokenType) Priority() opPriority {
 		return priorityPREFIX
 	case CLAUSE:
 		return priorityCLAUSE
-	case CHAR, STRING, NUMBER, BOOL, VARIABLE, SELECTOR, ACCESSOR, FUNC, LITERAL:
+	case CHAR, STRING, NUMBER, BOOL, NIL, VARIABLE, SELECTOR, ACCESSOR, OPTIONAL, FUNC, ARRAY, LITERAL:
 		return priorityLITERAL
 	}
 	return priorityUNKNOWN
@@ -189,47 +223,28 @@ func (op TokenType) isLogical() bool {
 	return op == LAND || op == LOR
 }
 
-func (op TokenType) isShortCircuit() bool {
-	return op.isTernary() || op.isLogical()
-}
-
-var tokenCOMPARER = map[TokenType]struct{}{
-	EQ:  {},
-	NEQ: {},
-	GT:  {},
-	GEQ: {},
-	LT:  {},
-	LEQ: {},
+// isBinary reports whether the operator is put between two operands,
+// TERNARY_ELSE is excluded as it can only follow a TERNARY_IF
+func (op TokenType) isBinary() bool {
+	priority := op.Priority()
+	return op != TERNARY_ELSE && priorityTENARY <= priority && priority <= priorityMUL
 }
 
-var tokenPREFIX = map[TokenType]struct{}{
-	NEG: {},
-	NOT: {},
-}
-
-var tokenBIT = map[TokenType]struct{}{
-	XOR: {},
-	AND: {},
-	OR:  {},
-}
-
-var tokenBITSHIFT = map[TokenType]struct{}{
-	SHR: {},
-	SHL: {},
+func (op TokenType) isShortCircuit() bool {
+	return op.isTernary() || op.isLogical() || op == COALESCE
 }
 
-var tokenADD = map[TokenType]struct{}{
-	ADD: {},
-	SUB: {},
+// isNilSafe reports whether an unknown parameter on the left of the operator is taken as nil
+func (op TokenType) isNilSafe() bool {
+	return op == COALESCE || op == OPTIONAL
 }
 
-var tokenMUL = map[TokenType]struct{}{
-	MUL: {},
-	QUO: {},
-	REM: {},
+var tokenMATCH = map[TokenType]struct{}{
+	MATCH:     {},
+	NOT_MATCH: {},
 }
 
-var tokenTERNARY = map[TokenType]struct{}{
-	TERNARY_IF:   {},
-	TERNARY_ELSE: {},
+var tokenPREFIX = map[TokenType]struct{}{
+	NEG: {},
+	NOT: {},
 }
@@ -0,0 +1,239 @@
+package goexpr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Trace is the evaluation of a node of an expression, returned by EvalTrace
+type Trace struct {
+	Node           Node        // node of the syntax tree, as returned by AST, which tells the span of the node
+	Op             string      // operator, function or method of the node, empty for literals and parameters
+	Text           string      // source of the node within the input
+	Value          interface{} // value of the node, nil when it failed or was not evaluated
+	Err            error       // error of the node, if it failed
+	ShortCircuited bool        // the node was not evaluated, being skipped by &&, ||, ?? or ?:
+	Children       []*Trace    // operands of the node, in the order they are evaluated
+
+	node *astNode
+}
+
+// EvalTrace evaluates the expression like Eval, and returns the evaluation of every node as well,
+// e.g. to tell which comparison made a rule false. each node counts as one step of the limits.
+// the trace of the nodes evaluated before a failure is returned along with the error,
+// nodes which were not evaluated because of the failure are left out
+func (expr *Expr) EvalTrace(params map[string]interface{}) (interface{}, *Trace, error) {
+	if expr.astNode == nil {
+		return nil, nil, nil
+	}
+	t := &tracer{root: &Trace{}, nodes: map[*astNode]Node{}, input: expr.input}
+	exporter{input: expr.input, nodes: t.nodes}.export(expr.astNode)
+	t.stack = []*Trace{t.root}
+
+	ctx := &evalContext{
+		params:  MapParameters(params),
+		fields:  expr.fields,
+		context: context.Background(),
+		limits:  expr.limits,
+		tracer:  t,
+	}
+	res, err := expr.eval(expr.astNode, ctx)
+	var trace *Trace
+	if len(t.root.Children) > 0 {
+		trace = t.root.Children[0]
+	}
+	if err != nil {
+		return nil, trace, withInput(err, expr.input)
+	}
+	return res, trace, nil
+}
+
+// tracer records the evaluation of the nodes walked by Expr.eval
+type tracer struct {
+	root  *Trace   // holds the trace of the root node
+	stack []*Trace // traces of the nodes being evaluated, the innermost is the last
+	nodes map[*astNode]Node
+	input string
+	steps int
+}
+
+// enter starts the trace of node, nil for the nodes which are not in the syntax tree
+// such as parentheses, the traces of their operands are given to the enclosing node
+func (t *tracer) enter(node *astNode, limits *Limits) (*Trace, error) {
+	if limits != nil && limits.MaxSteps > 0 {
+		if t.steps++; t.steps > limits.MaxSteps {
+			return nil, newLimitError(ErrTooManySteps, node.pos, node.end, "evaluation takes more than %d steps", limits.MaxSteps)
+		}
+	}
+	if node.operator == CLAUSE || node.operator == ACCESSOR {
+		return nil, nil
+	}
+	trace := t.trace(node)
+	parent := t.stack[len(t.stack)-1]
+	parent.Children = append(parent.Children, trace)
+	t.stack = append(t.stack, trace)
+	return trace, nil
+}
+
+// leave ends the trace of a node with its result, the operands skipped by
+// a short-circuit operator are traced as such
+func (t *tracer) leave(trace *Trace, value interface{}, err error) {
+	if trace == nil {
+		return
+	}
+	t.stack = t.stack[:len(t.stack)-1]
+	trace.Value, trace.Err = value, err
+	if err != nil || !trace.node.operator.isShortCircuit() {
+		return
+	}
+
+	evaluated := make(map[*astNode]*Trace, len(trace.Children))
+	for _, child := range trace.Children {
+		evaluated[child.node] = child
+	}
+	trace.Children = trace.Children[:0]
+	for _, operand := range traceOperands(trace.node) {
+		child, ok := evaluated[operand]
+		if !ok {
+			child = t.skipped(operand)
+		}
+		trace.Children = append(trace.Children, child)
+	}
+}
+
+func (t *tracer) trace(node *astNode) *Trace {
+	n := t.nodes[node]
+	return &Trace{
+		Node: n,
+		Op:   traceOp(n),
+		Text: sourceText(t.input, n.Pos(), n.End()),
+		node: node,
+	}
+}
+
+// sourceText returns the source of the span from pos to end, clamped to the input
+// so that a span which does not match the input gives a partial text rather than a panic
+func sourceText(input string, pos, end Position) string {
+	from, to := pos.Offset, end.Offset
+	if to > len(input) {
+		to = len(input)
+	}
+	if from < 0 {
+		from = 0
+	}
+	if from > to {
+		return ""
+	}
+	return input[from:to]
+}
+
+// skipped returns the trace of node and its operands which were not evaluated
+func (t *tracer) skipped(node *astNode) *Trace {
+	trace := t.trace(node)
+	trace.ShortCircuited = true
+	for _, operand := range traceOperands(node) {
+		trace.Children = append(trace.Children, t.skipped(operand))
+	}
+	return trace
+}
+
+// traceOperands returns the operands of node which are traced, in the order they are evaluated:
+// the branches of a ternary are its operands, as are the operands within parentheses
+func traceOperands(node *astNode) []*astNode {
+	var operands []*astNode
+	var add func(n *astNode)
+	add = func(n *astNode) {
+		switch {
+		case n == nil || n.operator == ACCESSOR:
+		case n.operator == CLAUSE:
+			add(n.right)
+		case n.operator == TERNARY_ELSE:
+			add(n.left)
+			add(n.right)
+		default:
+			operands = append(operands, n)
+		}
+	}
+	add(node.left)
+	add(node.right)
+	for _, r := range node.rightList {
+		add(r)
+	}
+	return operands
+}
+
+// traceOp returns the operator of a node of the syntax tree
+func traceOp(node Node) string {
+	switch n := node.(type) {
+	case *Selector:
+		if n.Optional {
+			return "?."
+		}
+		return "."
+	case *Index:
+		return "[]"
+	case *Unary:
+		return n.Op.String()
+	case *Binary:
+		return n.Op.String()
+	case *Ternary:
+		return "?:"
+	case *Call:
+		return n.Name
+	case *Array:
+		return "[]"
+	}
+	return ""
+}
+
+// String renders the trace as indented text, one node per line with its value:
+//
+//	age >= 18 && country == "FR" = false
+//	  age >= 18 = false
+//	    age = 17
+//	    18 = 18
+//	  country == "FR" (short-circuited)
+func (t *Trace) String() string {
+	var b strings.Builder
+	t.write(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (t *Trace) write(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	// the source of a node may span several lines
+	b.WriteString(strings.Join(strings.Fields(t.Text), " "))
+	switch {
+	case t.ShortCircuited:
+		b.WriteString(" (short-circuited)")
+	case t.Err != nil:
+		b.WriteString(" failed: ")
+		if e, ok := t.Err.(*Error); ok {
+			b.WriteString(e.Msg)
+		} else {
+			b.WriteString(t.Err.Error())
+		}
+	default:
+		b.WriteString(" = ")
+		b.WriteString(traceValue(t.Value))
+	}
+	b.WriteByte('\n')
+	for _, child := range t.Children {
+		child.write(b, depth+1)
+	}
+}
+
+// traceValue renders a value, strings and chars are quoted so that they are told apart from other values
+func traceValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case rune:
+		return strconv.QuoteRune(v)
+	case nil:
+		return "nil"
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,247 @@
+package goexpr
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvalTrace(t *testing.T) {
+	params := map[string]interface{}{
+		"age":     17,
+		"country": "FR",
+		"x":       2,
+		"u":       map[string]interface{}{"a": []interface{}{1, 2}},
+		"bob":     &testUser{First: "Bob"},
+		"s":       "hi",
+	}
+	tests := []struct {
+		input  string
+		wanted []string
+	}{
+		{"age >= 18 && country == \"FR\"", []string{
+			`age >= 18 && country == "FR" = false`,
+			`  age >= 18 = false`,
+			`    age = 17`,
+			`    18 = 18`,
+			`  country == "FR" (short-circuited)`,
+			`    country (short-circuited)`,
+			`    "FR" (short-circuited)`,
+		}},
+		{"(x > 1 ? u.a[x - 1] : 0) + (1 + 2)", []string{
+			`(x > 1 ? u.a[x - 1] : 0) + (1 + 2) = 5`,
+			`  x > 1 ? u.a[x - 1] : 0 = 2`,
+			`    x > 1 = true`,
+			`      x = 2`,
+			`      1 = 1`,
+			`    u.a[x - 1] = 2`,
+			`      x - 1 = 1`,
+			`        x = 2`,
+			`        1 = 1`,
+			`    0 (short-circuited)`,
+			`  1 + 2 = 3`,
+		}},
+		{"missing ?? bob.Greet(s\n+ \"!\")", []string{
+			`missing ?? bob.Greet(s + "!") = "hi!, Bob"`,
+			`  missing failed: no parameter missing found`,
+			`  bob.Greet(s + "!") = "hi!, Bob"`,
+			`    bob = &{Bob  0 []}`,
+			`    s + "!" = "hi!"`,
+			`      s = "hi"`,
+			`      "!" = "!"`,
+		}},
+		{"x ?? y ?? z", []string{
+			`x ?? y ?? z = 2`,
+			`  x ?? y = 2`,
+			`    x = 2`,
+			`    y (short-circuited)`,
+			`  z (short-circuited)`,
+		}},
+		{"x > 1 ? 'y'", []string{
+			`x > 1 ? 'y' = 'y'`,
+			`  x > 1 = true`,
+			`    x = 2`,
+			`    1 = 1`,
+			`  'y' = 'y'`,
+		}},
+	}
+
+	for _, test := range tests {
+		expr, err := NewExpr(test.input)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", test.input, err)
+			continue
+		}
+		_, trace, err := expr.EvalTrace(params)
+		if err != nil {
+			t.Errorf("input %s failed: %s", test.input, err)
+			continue
+		}
+		if s, wanted := trace.String(), strings.Join(test.wanted, "\n"); s != wanted {
+			t.Errorf("input %s: trace\n%s\ndoes not match wanted:\n%s", test.input, s, wanted)
+		}
+	}
+}
+
+func TestEvalTraceNodes(t *testing.T) {
+	expr, err := NewExpr("a || !b", WithoutOptimization())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, trace, err := expr.EvalTrace(map[string]interface{}{"a": true})
+	if err != nil || res != true {
+		t.Fatalf("result '%v', error %v", res, err)
+	}
+	if trace.Op != "||" || trace.Value != true || len(trace.Children) != 2 || trace.Node.Pos().Column != 1 {
+		t.Errorf("trace of || is %+v", trace)
+	}
+	if a := trace.Children[0]; a.Op != "" || a.Text != "a" || a.ShortCircuited || a.Value != true {
+		t.Errorf("trace of a is %+v", a)
+	}
+	not := trace.Children[1]
+	if _, ok := not.Node.(*Unary); !ok || not.Op != "!" || !not.ShortCircuited || not.Node.Pos().Column != 6 {
+		t.Errorf("trace of !b is %+v", not)
+	}
+	if b := not.Children[0]; b.Text != "b" || !b.ShortCircuited || b.Value != nil {
+		t.Errorf("trace of b is %+v", b)
+	}
+
+	// the trace of the nodes evaluated before a failure is returned
+	expr, err = NewExpr("a && b > 1 && c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, trace, err = expr.EvalTrace(map[string]interface{}{"a": true, "b": "x"})
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("error %v should be a type mismatch", err)
+	}
+	wanted := strings.Join([]string{
+		`a && b > 1 && c failed: value 'x' cannot be used with the COMPARER operator '>', it is not a number`,
+		`  a && b > 1 failed: value 'x' cannot be used with the COMPARER operator '>', it is not a number`,
+		`    a = true`,
+		`    b > 1 failed: value 'x' cannot be used with the COMPARER operator '>', it is not a number`,
+		`      b = "x"`,
+		`      1 = 1`,
+	}, "\n")
+	if s := trace.String(); s != wanted {
+		t.Errorf("trace\n%s\ndoes not match wanted:\n%s", s, wanted)
+	}
+
+	expr, err = NewExpr("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, trace, err := expr.EvalTrace(nil); res != nil || trace != nil || err != nil {
+		t.Errorf("result '%v', trace %v, error %v", res, trace, err)
+	}
+}
+
+// the traced evaluation gives the same results and errors as Eval
+func TestEvalTraceMatchesEval(t *testing.T) {
+	params := map[string]interface{}{
+		"x":       int64(7),
+		"f":       2.5,
+		"s":       "abc",
+		"ok":      true,
+		"list":    []interface{}{10, 20, 30},
+		"user":    map[string]interface{}{"name": "Bob", "nickname": nil},
+		"profile": &testProfile{Address: &testAddress{City: "Paris"}},
+		"bob":     &testUser{First: "Bob", Last: "Smith"},
+	}
+	inputs := []string{
+		"1 + 2 * 3 - 4 / 5",
+		"x > 5 && f < 3 || !ok",
+		"x > 5 ? x > 6 ? 1 : 2 : 3",
+		"x < 5 ? 1",
+		"list[1] + list[x - 5]",
+		"list[3]",
+		"user.alias ?? missing ?? user.name",
+		`profile?.Address?.City == "Paris"`,
+		"visitor?.name ?? (x > 1 ? \"guest\" : nil)",
+		"x in [1, x, 3] && s not in []",
+		`s =~ "^a" && s !~ "c$"`,
+		"[x, [s], nil]",
+		"bob.FullName() + bob.Greet(\"Hi\")",
+		"1 / (x - 7)",
+		"unknown > 1",
+		"ok ? list[0] : missing",
+	}
+
+	for _, opts := range [][]Option{nil, {WithoutOptimization()}} {
+		for _, input := range inputs {
+			expr, err := NewExprWithFunctions(input, testFunctions, opts...)
+			if err != nil {
+				t.Errorf("input %s failed to parse: %s", input, err)
+				continue
+			}
+			wanted, wantedErr := expr.Eval(params)
+			res, trace, err := expr.EvalTrace(params)
+			if !reflect.DeepEqual(res, wanted) {
+				t.Errorf("input %s: traced result '%v' does not match '%v'", input, res, wanted)
+			}
+			if (err == nil) != (wantedErr == nil) || (err != nil && err.Error() != wantedErr.Error()) {
+				t.Errorf("input %s: traced error '%v' does not match '%v'", input, err, wantedErr)
+			}
+			if err == nil && !reflect.DeepEqual(trace.Value, res) {
+				t.Errorf("input %s: value '%v' of the trace does not match '%v'", input, trace.Value, res)
+			}
+		}
+	}
+}
+
+func TestEvalTraceLimits(t *testing.T) {
+	expr, err := NewExpr("a + b + c", WithLimits(Limits{MaxSteps: 4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]interface{}{"a": 1, "b": 2, "c": 3}
+	if _, _, err = expr.EvalTrace(params); !errors.Is(err, ErrTooManySteps) {
+		t.Errorf("error %v should be a limit of steps", err)
+	}
+
+	expr, err = NewExpr("s + s", WithLimits(Limits{MaxStringLength: 4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, trace, err := expr.EvalTrace(map[string]interface{}{"s": "abc"})
+	if !errors.Is(err, ErrValueTooLarge) || !errors.Is(trace.Err, ErrValueTooLarge) {
+		t.Errorf("error %v should be a limit of values", err)
+	}
+}
+
+// the trace of an expression whose spans do not match its input gives partial texts rather than panicking
+func TestEvalTraceInvalidSpans(t *testing.T) {
+	spans := [][2]int{{0, 500}, {3, 1}, {-2, 2}, {-5, -1}, {600, 700}}
+	for _, span := range spans {
+		for _, input := range []string{"a + 1 > 0 && a[0] == b.c", "f(a) ?? [a, 'x'] || !(a[0] > 1 ? b?.c : 2) && b.F()"} {
+			expr, err := NewExprWithFunctions(input, map[string]ExprFunc{"f": func(args ...interface{}) (interface{}, error) {
+				return args, nil
+			}}, WithoutOptimization())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tamper func(node *astNode)
+			tamper = func(node *astNode) {
+				if node == nil {
+					return
+				}
+				node.pos.Offset, node.end.Offset = span[0], span[1]
+				tamper(node.left)
+				tamper(node.right)
+				for _, r := range node.rightList {
+					tamper(r)
+				}
+			}
+			tamper(expr.astNode)
+
+			params := map[string]interface{}{"a": []interface{}{1}, "b": map[string]interface{}{"c": 1}}
+			if _, trace, _ := expr.EvalTrace(params); trace == nil {
+				t.Errorf("input %s with span %v: trace should be returned", input, span)
+			}
+			if _, _, err := expr.Explain(params); err != nil && !errors.Is(err, ErrTypeMismatch) {
+				t.Errorf("input %s with span %v: error %v", input, span, err)
+			}
+		}
+	}
+}
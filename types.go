@@ -0,0 +1,304 @@
+package goexpr
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of the values of a Type
+type Kind int
+
+const (
+	KindAny    Kind = iota // any value, only known once evaluated
+	KindNil                // nil
+	KindBool               // bool
+	KindInt                // int64, which Go integers are converted to
+	KindFloat              // float64, which float32 is converted to
+	KindString             // string
+	KindChar               // rune, such as 'a' or a character of a string
+	KindArray              // arrays and slices
+	KindMap                // maps, whatever their keys
+	KindStruct             // structs, and maps with known keys
+)
+
+var kinds = [...]string{
+	KindAny:    "any",
+	KindNil:    "nil",
+	KindBool:   "bool",
+	KindInt:    "int",
+	KindFloat:  "float",
+	KindString: "string",
+	KindChar:   "char",
+	KindArray:  "array",
+	KindMap:    "map",
+	KindStruct: "struct",
+}
+
+func (k Kind) String() string {
+	if 0 <= k && int(k) < len(kinds) {
+		return kinds[k]
+	}
+	return "kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Type is the type of a parameter or of the value of an expression, the fields of struct types
+// made of Go types are named as told by the options of the expression, e.g. WithFieldTag
+type Type struct {
+	kind   Kind
+	elem   *Type            // elements of arrays and maps
+	fields map[string]*Type // fields of structs declared by StructOf or by a sample map
+	goType reflect.Type     // Go type the type is made of, if any, which tells the fields and the methods
+}
+
+// types of the values of literals and operators
+var (
+	AnyType    = &Type{kind: KindAny}
+	NilType    = &Type{kind: KindNil}
+	BoolType   = &Type{kind: KindBool}
+	IntType    = &Type{kind: KindInt}
+	FloatType  = &Type{kind: KindFloat}
+	StringType = &Type{kind: KindString}
+	CharType   = &Type{kind: KindChar}
+)
+
+// ArrayOf returns the type of arrays of elem
+func ArrayOf(elem *Type) *Type {
+	return &Type{kind: KindArray, elem: elem}
+}
+
+// MapOf returns the type of maps of elem, whatever their keys
+func MapOf(elem *Type) *Type {
+	return &Type{kind: KindMap, elem: elem}
+}
+
+// StructOf returns the type of structs, or of maps, with the given fields
+func StructOf(fields map[string]*Type) *Type {
+	t := &Type{kind: KindStruct, fields: make(map[string]*Type, len(fields))}
+	for name, field := range fields {
+		t.fields[name] = field
+	}
+	return t
+}
+
+// TypeOf returns the type of the sample value v: the keys of maps with string keys are their fields,
+// the type of an interface is the type of its value, and nil is of any type
+func TypeOf(v interface{}) *Type {
+	return typeOfValue(reflect.ValueOf(v))
+}
+
+func typeOfValue(v reflect.Value) *Type {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return AnyType
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return typeFor(v.Type())
+		}
+		return typeOfValue(v.Elem())
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		t := &Type{kind: KindStruct, fields: make(map[string]*Type, v.Len())}
+		for iter := v.MapRange(); iter.Next(); {
+			t.fields[iter.Key().String()] = typeOfValue(iter.Value())
+		}
+		return t
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Interface {
+			break
+		}
+		if v.Len() == 0 {
+			return ArrayOf(AnyType)
+		}
+		elem := typeOfValue(v.Index(0))
+		for i := 1; i < v.Len(); i++ {
+			elem = joinTypes(elem, typeOfValue(v.Index(i)))
+		}
+		return ArrayOf(elem)
+	}
+	return typeFor(v.Type())
+}
+
+// typeFor returns the type of the values of the Go type t, once converted by convert2Number,
+// which leaves the values of named types as they are, such as time.Duration
+func typeFor(t reflect.Type) *Type {
+	basic := t.Kind() == reflect.String || (reflect.Bool <= t.Kind() && t.Kind() <= reflect.Complex128)
+	if basic && t.Name() != t.Kind().String() {
+		return &Type{kind: KindAny, goType: t}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeFor(t.Elem())
+	case reflect.Interface:
+		return AnyType
+	case reflect.Bool:
+		return BoolType
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return IntType
+	case reflect.Int32:
+		return CharType
+	case reflect.Float32, reflect.Float64:
+		return FloatType
+	case reflect.String:
+		return StringType
+	case reflect.Slice, reflect.Array:
+		return &Type{kind: KindArray, elem: typeFor(t.Elem()), goType: t}
+	case reflect.Map:
+		return &Type{kind: KindMap, elem: typeFor(t.Elem()), goType: t}
+	case reflect.Struct:
+		return &Type{kind: KindStruct, goType: t}
+	}
+	return &Type{kind: KindAny, goType: t}
+}
+
+// Kind returns the kind of t
+func (t *Type) Kind() Kind {
+	return t.kind
+}
+
+// Elem returns the type of the elements of an array or map type, nil for other types
+func (t *Type) Elem() *Type {
+	return t.elem
+}
+
+func (t *Type) String() string {
+	switch {
+	case t.goType != nil && (t.kind == KindStruct || t.kind == KindAny):
+		return t.goType.String()
+	case t.kind == KindArray:
+		return "[]" + t.elem.String()
+	case t.kind == KindMap:
+		return "map[" + t.elem.String() + "]"
+	case t.kind == KindStruct:
+		names := make([]string, 0, len(t.fields))
+		for name := range t.fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			names[i] = name + " " + t.fields[name].String()
+		}
+		return "{" + strings.Join(names, "; ") + "}"
+	}
+	return t.kind.String()
+}
+
+// isNumber reports whether the values of t may be numbers
+func (t *Type) isNumber() bool {
+	return t.kind == KindInt || t.kind == KindFloat || t.kind == KindAny
+}
+
+// isString reports whether the values of t may be strings
+func (t *Type) isString() bool {
+	return t.kind == KindString || t.kind == KindAny
+}
+
+// isBool reports whether the values of t may be bools
+func (t *Type) isBool() bool {
+	return t.kind == KindBool || t.kind == KindAny
+}
+
+// assignableTo reports whether the values of t may be given to a method parameter of type p,
+// as convertArgument does
+func (t *Type) assignableTo(p reflect.Type) bool {
+	switch t.kind {
+	case KindAny:
+		return true
+	case KindNil:
+		switch p.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return true
+		}
+		return false
+	}
+	if p.Kind() == reflect.Interface {
+		return true
+	}
+	switch t.kind {
+	case KindInt, KindFloat, KindChar:
+		return isNumericKind(p.Kind())
+	case KindBool:
+		return p.Kind() == reflect.Bool
+	case KindString:
+		return p.Kind() == reflect.String
+	}
+	return true
+}
+
+// field returns the type of the field name of t, false if t has no such field
+func (t *Type) field(name string, naming fieldNaming) (*Type, bool) {
+	switch t.kind {
+	case KindAny:
+		return AnyType, true
+	case KindMap:
+		return t.elem, true
+	case KindStruct:
+		if t.goType == nil {
+			field, ok := t.fields[name]
+			return field, ok
+		}
+		fields := cachedFields(t.goType, naming)
+		index, ok := fields.names[name]
+		if !ok && fields.folded != nil {
+			index, ok = fields.folded[strings.ToLower(name)]
+		}
+		if !ok {
+			return nil, false
+		}
+		return typeFor(t.goType.FieldByIndex(index).Type), true
+	}
+	return nil, false
+}
+
+// method returns the type of the method name of t without its receiver,
+// methods with a pointer receiver are found too as callMethod calls them on a pointer
+func (t *Type) method(name string) (reflect.Type, bool) {
+	if t.goType == nil {
+		return nil, false
+	}
+	m, ok := t.goType.MethodByName(name)
+	if !ok {
+		if m, ok = reflect.PtrTo(t.goType).MethodByName(name); !ok {
+			return nil, false
+		}
+	}
+	in := make([]reflect.Type, m.Type.NumIn()-1)
+	for i := range in {
+		in[i] = m.Type.In(i + 1)
+	}
+	out := make([]reflect.Type, m.Type.NumOut())
+	for i := range out {
+		out[i] = m.Type.Out(i)
+	}
+	return reflect.FuncOf(in, out, m.Type.IsVariadic()), true
+}
+
+// joinTypes returns the type of values either of type a or of type b
+func joinTypes(a, b *Type) *Type {
+	switch {
+	case a == b || b.kind == KindNil:
+		return a
+	case a.kind == KindNil:
+		return b
+	case a.kind != b.kind || a.kind == KindAny:
+		return AnyType
+	}
+	switch a.kind {
+	case KindArray, KindMap:
+		elem := joinTypes(a.elem, b.elem)
+		if elem == a.elem {
+			return a
+		}
+		return &Type{kind: a.kind, elem: elem}
+	case KindStruct:
+		if a.goType != nil && a.goType == b.goType {
+			return a
+		}
+		return AnyType
+	}
+	return a
+}
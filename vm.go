@@ -0,0 +1,289 @@
+package goexpr
+
+import "errors"
+
+// the AST is lowered into a flat list of instructions run by a stack machine,
+// which evaluates operands before their operator as the tree walker does,
+// operators keep their type checks and calculators so that both give the same results
+
+type opcode uint8
+
+const (
+	opConst        opcode = iota // push the value of a constant node
+	opParam                      // push the value of the parameter at the path of node
+	opCall                       // pop the operands of node, check their types and push the result of its calculator
+	opJump                       // jump to arg
+	opJumpIfFalse                // LAND: replace the top with false and jump to arg if it is false
+	opJumpIfTrue                 // LOR: replace the top with true and jump to arg if it is true
+	opJumpIfNotNil               // COALESCE: jump to arg keeping the top if it is not nil
+	opBranch                     // TERNARY_IF: pop the condition and jump to arg if it is false
+	opGuard                      // take an unknown parameter as nil until the matching opUnguard at arg
+	opUnguard                    // end of the innermost guard
+)
+
+// operands of an opCall
+const (
+	withLeft  uint8 = 1 << iota // node has a left operand
+	withRight                   // node has a right operand
+	withList                    // node has a list of right operands, arg is their count
+)
+
+type instruction struct {
+	op    opcode
+	flags uint8
+	arg   int
+	node  *astNode // node the instruction is emitted for, whose span locates errors
+}
+
+type program struct {
+	instructions []instruction
+}
+
+// compile lowers the AST into a program
+func compile(node *astNode) *program {
+	p := &program{}
+	if node != nil {
+		p.emit(node)
+	}
+	return p
+}
+
+func (p *program) add(ins instruction) int {
+	p.instructions = append(p.instructions, ins)
+	return len(p.instructions) - 1
+}
+
+// patch makes the jump at pc go to the next instruction to be emitted
+func (p *program) patch(pc int) {
+	p.instructions[pc].arg = len(p.instructions)
+}
+
+func (p *program) emit(node *astNode) {
+	if node.constant {
+		p.add(instruction{op: opConst, node: node})
+		return
+	}
+	if node.isParam() {
+		p.add(instruction{op: opParam, node: node})
+		return
+	}
+
+	switch node.operator {
+	case TERNARY_IF:
+		p.emitTernary(node)
+		return
+	case LAND, LOR, COALESCE:
+		p.emitLeft(node)
+		jump := opJumpIfFalse
+		if node.operator == LOR {
+			jump = opJumpIfTrue
+		} else if node.operator == COALESCE {
+			jump = opJumpIfNotNil
+		}
+		pc := p.add(instruction{op: jump, node: node})
+		p.emit(node.right)
+		p.add(instruction{op: opCall, flags: withLeft | withRight, node: node})
+		p.patch(pc)
+		return
+	}
+
+	var flags uint8
+	if node.left != nil {
+		flags |= withLeft
+		p.emitLeft(node)
+	}
+	if node.right != nil {
+		flags |= withRight
+		p.emit(node.right)
+	} else if node.rightList != nil {
+		flags |= withList
+		for _, r := range node.rightList {
+			p.emit(r)
+		}
+	}
+	p.add(instruction{op: opCall, flags: flags, arg: len(node.rightList), node: node})
+}
+
+// emitLeft emits the left operand of node, guarded when an unknown parameter is taken as nil by node
+func (p *program) emitLeft(node *astNode) {
+	if !node.operator.isNilSafe() || !node.left.isNilSafeOperand() {
+		p.emit(node.left)
+		return
+	}
+	pc := p.add(instruction{op: opGuard, node: node})
+	p.emit(node.left)
+	p.patch(pc)
+	p.add(instruction{op: opUnguard, node: node})
+}
+
+// cond ? then : else is lowered into
+//
+//	cond; branch to else; then; jump to end; else: else; end:
+func (p *program) emitTernary(node *astNode) {
+	p.emit(node.left)
+	branch := p.add(instruction{op: opBranch, node: node})
+
+	then, otherwise := node.right, (*astNode)(nil)
+	if then.operator == TERNARY_ELSE {
+		then, otherwise = then.left, then.right
+	}
+	p.emit(then)
+	jump := p.add(instruction{op: opJump, node: node})
+	p.patch(branch)
+	if otherwise != nil {
+		p.emit(otherwise)
+	} else {
+		p.add(instruction{op: opConst, node: &astNode{constant: true, pos: node.pos, end: node.end}})
+	}
+	p.patch(jump)
+}
+
+// guard records the state to restore when an unknown parameter is taken as nil
+type guard struct {
+	depth int // stack depth when the guard was entered
+	end   int // pc of the matching opUnguard
+}
+
+// run executes the program, it is safe to run the same program from multiple goroutines
+func (p *program) run(ctx *evalContext) (interface{}, error) {
+	if len(p.instructions) == 0 {
+		return nil, nil
+	}
+
+	var (
+		buffer [16]interface{} // most expressions do not need a deeper stack
+		stack  = buffer[:0]
+		guards []guard
+	)
+	var maxSteps, steps int
+	if ctx.limits != nil {
+		maxSteps = ctx.limits.MaxSteps
+	}
+	instructions := p.instructions
+	for pc := 0; pc < len(instructions); pc++ {
+		ins := &instructions[pc]
+		var err error
+		if maxSteps > 0 {
+			if steps++; steps > maxSteps {
+				return nil, newLimitError(ErrTooManySteps, ins.node.pos, ins.node.end, "evaluation takes more than %d steps", maxSteps)
+			}
+		}
+		if ctx.done != nil {
+			if err = ctx.interrupted(); err != nil {
+				return nil, wrapError(err, ins.node.pos, ins.node.end)
+			}
+		}
+		switch ins.op {
+		case opConst:
+			stack = append(stack, ins.node.value)
+			continue
+		case opParam:
+			var value interface{}
+			if value, err = ctx.params.get(ins.node.path, *ctx); err == nil {
+				stack = append(stack, value)
+				continue
+			}
+			err = wrapError(err, ins.node.pos, ins.node.end)
+		case opCall:
+			var (
+				left, right, res interface{}
+				rightList        []interface{}
+			)
+			n := len(stack)
+			if ins.flags&withList != 0 {
+				// the list may be kept by the calculator, e.g. as an array, so it cannot share the stack
+				n -= ins.arg
+				rightList = make([]interface{}, ins.arg)
+				copy(rightList, stack[n:])
+			} else if ins.flags&withRight != 0 {
+				n--
+				right = stack[n]
+			}
+			if ins.flags&withLeft != 0 {
+				n--
+				left = stack[n]
+			}
+			stack = stack[:n]
+			if res, err = call(ins.node, left, right, rightList, ctx); err == nil && ctx.limits != nil {
+				err = ctx.limits.checkValue(res)
+				if err != nil {
+					err = wrapError(err, ins.node.pos, ins.node.end)
+				}
+			}
+			if err == nil {
+				stack = append(stack, res)
+				continue
+			}
+		case opJump:
+			pc = ins.arg - 1
+			continue
+		case opJumpIfFalse:
+			if stack[len(stack)-1] == false {
+				stack[len(stack)-1] = _false
+				pc = ins.arg - 1
+			}
+			continue
+		case opJumpIfTrue:
+			if stack[len(stack)-1] == true {
+				stack[len(stack)-1] = _true
+				pc = ins.arg - 1
+			}
+			continue
+		case opJumpIfNotNil:
+			if !isNil(stack[len(stack)-1]) {
+				pc = ins.arg - 1
+			}
+			continue
+		case opBranch:
+			cond := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if err = typeCheck(ins.node, cond, nil); err == nil {
+				if cond != true {
+					pc = ins.arg - 1
+				}
+				continue
+			}
+			err = wrapError(err, ins.node.left.pos, ins.node.left.end)
+		case opGuard:
+			guards = append(guards, guard{depth: len(stack), end: ins.arg})
+			continue
+		case opUnguard:
+			guards = guards[:len(guards)-1]
+			continue
+		}
+
+		// an unknown parameter within a guard is taken as nil,
+		// the opUnguard at the end of the guard is skipped since the guard is removed here
+		if len(guards) == 0 || !errors.Is(err, ErrUnknownParameter) {
+			return nil, err
+		}
+		g := guards[len(guards)-1]
+		guards = guards[:len(guards)-1]
+		stack = append(stack[:g.depth], nil)
+		pc = g.end
+	}
+	return stack[len(stack)-1], nil
+}
+
+// call checks the types of the operands of node and runs its calculator
+func call(node *astNode, left, right interface{}, rightList []interface{}, ctx *evalContext) (interface{}, error) {
+	if node.leftCheck != nil || node.rightCheck != nil || node.bothCheck != nil {
+		if err := typeCheck(node, left, right); err != nil {
+			return nil, wrapError(err, node.pos, node.end)
+		}
+	}
+
+	var (
+		res interface{}
+		err error
+	)
+	if rightList != nil {
+		res, err = node.calculator(left, rightList, *ctx)
+	} else {
+		res, err = node.calculator(left, right, *ctx)
+	}
+	if err != nil {
+		return nil, wrapError(err, node.pos, node.end)
+	}
+	return res, nil
+}
@@ -0,0 +1,168 @@
+package goexpr
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var treeWalkerParams = map[string]interface{}{
+	"x":       int64(7),
+	"f":       2.5,
+	"n":       3,
+	"s":       "abc",
+	"c":       'b',
+	"ok":      true,
+	"list":    []interface{}{10, 20, 30},
+	"user":    map[string]interface{}{"name": "Bob", "nickname": nil},
+	"profile": &testProfile{Address: &testAddress{City: "Paris"}},
+	"empty":   &testProfile{},
+	"bob":     &testUser{First: "Bob", Last: "Smith"},
+	"alice":   &testUser{First: "Alice", Friends: []*testUser{{First: "Bob"}}},
+}
+
+// the compiled program and the tree walker must give the same results and errors,
+// every operator is evaluated at least once
+func TestProgramMatchesTreeWalker(t *testing.T) {
+	inputs := []string{
+		// arithmetic
+		"1 + 2 * 3 - 4 / 5",
+		"x % 4 + -x",
+		"x * f - 1",
+		"n * f + n",
+		"f / 0",
+		`s + "d" == "abcd"`,
+		"s + c",
+		"1 / (x - 7)",
+		"x % (x - 7)",
+		"9223372036854775807 + x",
+		"x * 9223372036854775807",
+		"-s",
+		"s * 2",
+		// bitwise
+		"x & 3 | 8 ^ 1",
+		"x << 2 >> 1",
+		"x << 63",
+		"x >> (0 - 1)",
+		"f & 1",
+		// comparison
+		"x == 7 && x != 8 && x < 8 && x <= 7 && x > 6 && x >= 7",
+		"s < \"abd\" && c > 'a'",
+		"s <= 1",
+		"nil == nil && user.nickname == nil && x != nil",
+		// logical
+		"x > 5 && f < 3 || !ok",
+		"false && unknown",
+		"true || unknown",
+		"1 && true",
+		"!x",
+		// ternary
+		"x > 5 ? x > 6 ? 1 : 2 : 3",
+		"x < 5 ? 1",
+		"x ? 1 : 2",
+		"(1 < 2) ? x : y",
+		// parameters, indexes and optional chaining
+		"list[1] + list[x - 5]",
+		"list[3]",
+		"list[s]",
+		"s[1] == 'b'",
+		"user.nickname ?? user.name",
+		"user.alias ?? missing ?? user.name",
+		"(user.alias ?? 1) + (missing ?? 2)",
+		"missing + 1 ?? 3",
+		"user.alias + 1",
+		`profile?.Address?.City == "Paris"`,
+		"empty?.Address?.City ?? \"nowhere\"",
+		"visitor?.name ?? (x > 1 ? \"guest\" : nil)",
+		"unknown > 1",
+		"ok ? list[0] : missing",
+		"(missing ?? 0) > 0 ? 1 : user.alias ?? 2",
+		// membership and match
+		"x in [1, x, 3] && s not in []",
+		"x in s",
+		`s =~ "^a" && s !~ "c$"`,
+		`s =~ s + "("`,
+		"x =~ s",
+		"[x, [s], nil]",
+		// functions and methods
+		"max(x, f, n) + len(s)",
+		"fail()",
+		"concat(s, x)",
+		"bob.FullName() + bob.Greet(\"Hi\")",
+		"alice.BestFriend().First",
+		"bob.BestFriend()",
+		"bob.AgeIn(1.5)",
+		"bob.Unknown()",
+	}
+
+	// constant subtrees are folded by default, they are kept as parsed without optimization
+	for _, opts := range [][]Option{nil, {WithoutOptimization()}} {
+		for _, input := range inputs {
+			expr, err := NewExprWithFunctions(input, testFunctions, opts...)
+			if err != nil {
+				t.Errorf("input %s failed to parse: %s", input, err)
+				continue
+			}
+			matchTreeWalker(t, expr, func() *evalContext {
+				return &evalContext{params: MapParameters(treeWalkerParams)}
+			})
+		}
+	}
+}
+
+// the limits of values and the interruption of the evaluation are enforced by both
+func TestProgramMatchesTreeWalkerLimits(t *testing.T) {
+	limits := &Limits{MaxStringLength: 4, MaxArrayLength: 2}
+	inputs := []string{
+		"s + s",
+		"s + \"d\"",
+		"[1, 2, 3]",
+		"[1, [2, 3]]",
+		"x in [1, 2, x]",
+		"ok ? s + s : 1",
+		"concat(s, s)",
+		"len(s + s)",
+		"list",
+		"list[0] + 1",
+	}
+	for _, opts := range [][]Option{nil, {WithoutOptimization()}} {
+		for _, input := range inputs {
+			expr, err := NewExprWithFunctions(input, testFunctions, opts...)
+			if err != nil {
+				t.Errorf("input %s failed to parse: %s", input, err)
+				continue
+			}
+			matchTreeWalker(t, expr, func() *evalContext {
+				return &evalContext{params: MapParameters(treeWalkerParams), limits: limits}
+			})
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, input := range []string{"x + 1", "bob.FullName()", "[x, s]", "ok ? 1 : 2"} {
+		expr, err := NewExprWithFunctions(input, testFunctions)
+		if err != nil {
+			t.Errorf("input %s failed to parse: %s", input, err)
+			continue
+		}
+		wanted, wantedErr := expr.eval(expr.astNode, &evalContext{params: MapParameters(treeWalkerParams), context: ctx, done: ctx.Done()})
+		res, err := expr.program.run(&evalContext{params: MapParameters(treeWalkerParams), context: ctx, done: ctx.Done()})
+		if res != nil || wanted != nil || !errors.Is(err, context.Canceled) || !errors.Is(wantedErr, context.Canceled) {
+			t.Errorf("input %s: result '%v', error '%v' and tree walker '%v', '%v' should be interrupted", input, res, err, wanted, wantedErr)
+		}
+	}
+}
+
+func matchTreeWalker(t *testing.T, expr *Expr, newContext func() *evalContext) {
+	t.Helper()
+	wanted, wantedErr := expr.eval(expr.astNode, newContext())
+	res, err := expr.program.run(newContext())
+	if !reflect.DeepEqual(res, wanted) {
+		t.Errorf("input %s: result '%v' does not match tree walker: '%v'", expr.input, res, wanted)
+	}
+	if (err == nil) != (wantedErr == nil) || (err != nil && err.Error() != wantedErr.Error()) {
+		t.Errorf("input %s: error '%v' does not match tree walker: '%v'", expr.input, err, wantedErr)
+	}
+}